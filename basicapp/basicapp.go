@@ -57,6 +57,7 @@ func New(config Config) (*BasicApp, error) {
 	{
 		c := legacyresource.Config{
 			HelmClient: config.HelmClient,
+			K8sClient:  config.Clients.K8sClient(),
 			Logger:     config.Logger,
 			Namespace:  config.App.Namespace,
 		}
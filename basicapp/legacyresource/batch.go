@@ -0,0 +1,250 @@
+package legacyresource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/giantswarm/helmclient/v2/pkg/helmclient"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+)
+
+const (
+	defaultMaxConcurrency = 4
+)
+
+// Release describes a single release installed by Batch.
+type Release struct {
+	Name   string
+	URL    string
+	Values string
+	// DependsOn lists the names of releases in the same batch which must be
+	// deployed before this release is installed.
+	DependsOn []string
+	// Conditions are waited for after the release got installed. Dependent
+	// releases are only installed once all conditions are met.
+	Conditions []Condition
+}
+
+type BatchConfig struct {
+	Logger   micrologger.Logger
+	Resource *Resource
+
+	// MaxConcurrency limits the number of releases installed in parallel.
+	// Defaults to 4. It must not be negative.
+	MaxConcurrency int
+}
+
+// Batch installs multiple releases using a Resource. Independent releases are
+// installed in parallel, dependent releases are installed once all of their
+// dependencies are deployed.
+type Batch struct {
+	logger   micrologger.Logger
+	resource releaser
+
+	maxConcurrency int
+}
+
+// releaser is the subset of Resource used by Batch.
+type releaser interface {
+	EnsureDeleted(ctx context.Context, name string) error
+	Install(name, url, values string, conditions ...Condition) error
+	WaitForStatus(release string, status string) error
+}
+
+func NewBatch(config BatchConfig) (*Batch, error) {
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+	if config.Resource == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Resource must not be empty", config)
+	}
+	if config.MaxConcurrency < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.MaxConcurrency must not be negative", config)
+	}
+
+	if config.MaxConcurrency == 0 {
+		config.MaxConcurrency = defaultMaxConcurrency
+	}
+
+	b := &Batch{
+		logger:   config.Logger,
+		resource: config.Resource,
+
+		maxConcurrency: config.MaxConcurrency,
+	}
+
+	return b, nil
+}
+
+// EnsureDeleted deletes the given releases in reverse dependency order, so that
+// releases are deleted before the releases they depend on.
+func (b *Batch) EnsureDeleted(ctx context.Context, releases []Release) error {
+	ordered, err := sortReleases(releases)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for i := len(ordered) - 1; i >= 0; i-- {
+		err = b.resource.EnsureDeleted(ctx, ordered[i].Name)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// Install installs the given releases. The first failing release cancels all
+// releases which did not start yet and its error is returned.
+func (b *Batch) Install(ctx context.Context, releases []Release) error {
+	ordered, err := sortReleases(releases)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	deployed := map[string]chan struct{}{}
+	for _, r := range ordered {
+		deployed[r.Name] = make(chan struct{})
+	}
+
+	var once sync.Once
+	var installErr error
+	fail := func(err error) {
+		once.Do(func() {
+			installErr = err
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, b.maxConcurrency)
+
+	for _, r := range ordered {
+		wg.Add(1)
+
+		go func(r Release) {
+			defer wg.Done()
+
+			for _, d := range r.DependsOn {
+				select {
+				case <-deployed[d]:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			err := b.install(ctx, r)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			close(deployed[r.Name])
+		}(r)
+	}
+
+	wg.Wait()
+
+	if installErr != nil {
+		return microerror.Mask(installErr)
+	}
+
+	return nil
+}
+
+func (b *Batch) install(ctx context.Context, r Release) error {
+	b.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("installing release %#q", r.Name))
+
+	err := b.resource.Install(r.Name, r.URL, r.Values, r.Conditions...)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = b.resource.WaitForStatus(r.Name, helmclient.StatusDeployed)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	b.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("installed release %#q", r.Name))
+
+	return nil
+}
+
+// sortReleases returns the given releases ordered such that every release
+// comes after all of its dependencies. Releases without dependencies between
+// each other keep their given order.
+func sortReleases(releases []Release) ([]Release, error) {
+	byName := map[string]Release{}
+	for _, r := range releases {
+		if r.Name == "" {
+			return nil, microerror.Maskf(invalidConfigError, "release name must not be empty")
+		}
+		_, ok := byName[r.Name]
+		if ok {
+			return nil, microerror.Maskf(invalidConfigError, "release %#q defined twice", r.Name)
+		}
+		byName[r.Name] = r
+	}
+
+	for _, r := range releases {
+		for _, d := range r.DependsOn {
+			_, ok := byName[d]
+			if !ok {
+				return nil, microerror.Maskf(invalidConfigError, "release %#q depends on unknown release %#q", r.Name, d)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var ordered []Release
+	state := map[string]int{}
+
+	var visit func(r Release) error
+	visit = func(r Release) error {
+		switch state[r.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return microerror.Maskf(dependencyCycleError, "release %#q", r.Name)
+		}
+
+		state[r.Name] = visiting
+		for _, d := range r.DependsOn {
+			err := visit(byName[d])
+			if err != nil {
+				return microerror.Mask(err)
+			}
+		}
+		state[r.Name] = visited
+
+		ordered = append(ordered, r)
+
+		return nil
+	}
+
+	for _, r := range releases {
+		err := visit(r)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	return ordered, nil
+}
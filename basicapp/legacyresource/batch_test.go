@@ -0,0 +1,184 @@
+package legacyresource
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+type fakeReleaser struct {
+	mutex     sync.Mutex
+	installed []string
+	deleted   []string
+	failing   string
+}
+
+func (f *fakeReleaser) EnsureDeleted(ctx context.Context, name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.deleted = append(f.deleted, name)
+
+	return nil
+}
+
+func (f *fakeReleaser) Install(name, url, values string, conditions ...Condition) error {
+	if name == f.failing {
+		return errors.New("install failed")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.installed = append(f.installed, name)
+
+	return nil
+}
+
+func (f *fakeReleaser) WaitForStatus(release string, status string) error {
+	return nil
+}
+
+func Test_LegacyResource_Batch(t *testing.T) {
+	testCases := []struct {
+		name              string
+		releases          []Release
+		failing           string
+		expectedInstalled []string
+		expectedDeleted   []string
+		errorMatcher      func(error) bool
+	}{
+		{
+			name: "case 0: dependencies are installed first and deleted last",
+			releases: []Release{
+				{Name: "ingress", DependsOn: []string{"cert-manager", "dns"}},
+				{Name: "dns"},
+				{Name: "cert-manager", DependsOn: []string{"dns"}},
+			},
+			expectedInstalled: []string{"dns", "cert-manager", "ingress"},
+			expectedDeleted:   []string{"ingress", "cert-manager", "dns"},
+		},
+		{
+			name: "case 1: dependency cycles are rejected",
+			releases: []Release{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", DependsOn: []string{"a"}},
+			},
+			errorMatcher: IsDependencyCycle,
+		},
+		{
+			name: "case 2: unknown dependencies are rejected",
+			releases: []Release{
+				{Name: "a", DependsOn: []string{"missing"}},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 3: dependents of failed releases are not installed",
+			releases: []Release{
+				{Name: "cert-manager"},
+				{Name: "ingress", DependsOn: []string{"cert-manager"}},
+			},
+			failing:      "cert-manager",
+			errorMatcher: func(err error) bool { return err != nil },
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			r := &fakeReleaser{
+				failing: tc.failing,
+			}
+			b := &Batch{
+				logger:   microloggertest.New(),
+				resource: r,
+
+				maxConcurrency: 2,
+			}
+
+			err := b.Install(ctx, tc.releases)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if !reflect.DeepEqual(r.installed, tc.expectedInstalled) {
+				t.Fatalf("installed == %v, want %v", r.installed, tc.expectedInstalled)
+			}
+
+			if tc.errorMatcher != nil {
+				return
+			}
+
+			err = b.EnsureDeleted(ctx, tc.releases)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !reflect.DeepEqual(r.deleted, tc.expectedDeleted) {
+				t.Fatalf("deleted == %v, want %v", r.deleted, tc.expectedDeleted)
+			}
+		})
+	}
+}
+
+func Test_LegacyResource_NewBatch(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		maxConcurrency         int
+		expectedMaxConcurrency int
+		errorMatcher           func(error) bool
+	}{
+		{
+			name:                   "case 0: default max concurrency",
+			maxConcurrency:         0,
+			expectedMaxConcurrency: defaultMaxConcurrency,
+		},
+		{
+			name:                   "case 1: custom max concurrency",
+			maxConcurrency:         2,
+			expectedMaxConcurrency: 2,
+		},
+		{
+			name:           "case 2: negative max concurrency",
+			maxConcurrency: -1,
+			errorMatcher:   IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			b, err := NewBatch(BatchConfig{
+				Logger:   microloggertest.New(),
+				Resource: &Resource{},
+
+				MaxConcurrency: tc.maxConcurrency,
+			})
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if err == nil && b.maxConcurrency != tc.expectedMaxConcurrency {
+				t.Fatalf("%s: max concurrency == %d, want %d", tc.name, b.maxConcurrency, tc.expectedMaxConcurrency)
+			}
+		})
+	}
+}
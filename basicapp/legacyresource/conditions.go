@@ -0,0 +1,264 @@
+package legacyresource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultConditionTimeout is used for conditions not defining their own
+	// timeout.
+	defaultConditionTimeout = backoff.ShortMaxWait
+)
+
+// Condition is checked after a release got installed or updated. Check is
+// retried until it succeeds or Timeout is reached.
+type Condition struct {
+	// Name is used for logging.
+	Name string
+	// Check returns an error as long as the condition is not met. Errors
+	// wrapped using backoff.Permanent stop the retries immediately.
+	Check func(ctx context.Context) error
+	// Timeout is the maximum time the condition is retried. Defaults to
+	// backoff.ShortMaxWait.
+	Timeout time.Duration
+}
+
+// NewCondition wraps a plain function into a Condition.
+func NewCondition(name string, f func() error) Condition {
+	return Condition{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			return f()
+		},
+	}
+}
+
+// WithTimeout returns a copy of the condition using the given timeout.
+func (c Condition) WithTimeout(d time.Duration) Condition {
+	c.Timeout = d
+	return c
+}
+
+// CRDEstablished is met when the CRD with the given name is established.
+func CRDEstablished(extClient apiextensionsclient.Interface, name string) Condition {
+	return Condition{
+		Name: fmt.Sprintf("crd %#q established", name),
+		Check: func(ctx context.Context) error {
+			crd, err := extClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			for _, c := range crd.Status.Conditions {
+				if c.Type == apiextensionsv1.Established && c.Status == apiextensionsv1.ConditionTrue {
+					return nil
+				}
+			}
+
+			return microerror.Maskf(conditionNotMetError, "crd %#q is not established", name)
+		},
+	}
+}
+
+// DaemonSetRolledOut is met when all pods of the daemonset are updated to the
+// latest revision and available.
+func DaemonSetRolledOut(k8sClient kubernetes.Interface, namespace, name string) Condition {
+	return Condition{
+		Name: fmt.Sprintf("daemonset %#q rolled out", name),
+		Check: func(ctx context.Context) error {
+			ds, err := k8sClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			if ds.Status.ObservedGeneration < ds.Generation {
+				return microerror.Maskf(conditionNotMetError, "daemonset %#q generation %d not observed yet", name, ds.Generation)
+			}
+			if ds.Status.UpdatedNumberScheduled != ds.Status.DesiredNumberScheduled {
+				return microerror.Maskf(conditionNotMetError, "daemonset %#q want %d updated pods found %d", name, ds.Status.DesiredNumberScheduled, ds.Status.UpdatedNumberScheduled)
+			}
+			if ds.Status.NumberAvailable != ds.Status.DesiredNumberScheduled {
+				return microerror.Maskf(conditionNotMetError, "daemonset %#q want %d available pods found %d", name, ds.Status.DesiredNumberScheduled, ds.Status.NumberAvailable)
+			}
+
+			return nil
+		},
+	}
+}
+
+// DeploymentReady is met when all replicas of the deployment are updated to
+// the latest revision and ready.
+func DeploymentReady(k8sClient kubernetes.Interface, namespace, name string) Condition {
+	return Condition{
+		Name: fmt.Sprintf("deployment %#q ready", name),
+		Check: func(ctx context.Context) error {
+			d, err := k8sClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			replicas := int32(1)
+			if d.Spec.Replicas != nil {
+				replicas = *d.Spec.Replicas
+			}
+
+			if d.Status.ObservedGeneration < d.Generation {
+				return microerror.Maskf(conditionNotMetError, "deployment %#q generation %d not observed yet", name, d.Generation)
+			}
+			if d.Status.UpdatedReplicas != replicas {
+				return microerror.Maskf(conditionNotMetError, "deployment %#q want %d updated replicas found %d", name, replicas, d.Status.UpdatedReplicas)
+			}
+			if d.Status.ReadyReplicas != replicas {
+				return microerror.Maskf(conditionNotMetError, "deployment %#q want %d ready replicas found %d", name, replicas, d.Status.ReadyReplicas)
+			}
+
+			return nil
+		},
+	}
+}
+
+// EndpointsHaveAddresses is met when the endpoints of the service with the
+// given name have at least one ready address.
+func EndpointsHaveAddresses(k8sClient kubernetes.Interface, namespace, name string) Condition {
+	return Condition{
+		Name: fmt.Sprintf("endpoints %#q have addresses", name),
+		Check: func(ctx context.Context) error {
+			e, err := k8sClient.CoreV1().Endpoints(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			for _, s := range e.Subsets {
+				if len(s.Addresses) > 0 {
+					return nil
+				}
+			}
+
+			return microerror.Maskf(conditionNotMetError, "endpoints %#q have no ready addresses", name)
+		},
+	}
+}
+
+// JobSucceeded is met when the job completed successfully. A failed job stops
+// the retries immediately.
+func JobSucceeded(k8sClient kubernetes.Interface, namespace, name string) Condition {
+	return Condition{
+		Name: fmt.Sprintf("job %#q succeeded", name),
+		Check: func(ctx context.Context) error {
+			j, err := k8sClient.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			for _, c := range j.Status.Conditions {
+				if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+					return backoff.Permanent(microerror.Maskf(conditionNotMetError, "job %#q failed: %s", name, c.Message))
+				}
+			}
+
+			completions := int32(1)
+			if j.Spec.Completions != nil {
+				completions = *j.Spec.Completions
+			}
+
+			if j.Status.Succeeded < completions {
+				return microerror.Maskf(conditionNotMetError, "job %#q want %d succeeded pods found %d", name, completions, j.Status.Succeeded)
+			}
+
+			return nil
+		},
+	}
+}
+
+// URLReturnsOK is met when a GET request against the given URL returns 200.
+// When httpClient is nil http.DefaultClient is used.
+func URLReturnsOK(httpClient *http.Client, url string) Condition {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return Condition{
+		Name: fmt.Sprintf("url %#q returns 200", url),
+		Check: func(ctx context.Context) error {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				return backoff.Permanent(microerror.Mask(err))
+			}
+
+			res, err := httpClient.Do(req.WithContext(ctx))
+			if err != nil {
+				return microerror.Mask(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				return microerror.Maskf(conditionNotMetError, "url %#q returned %d", url, res.StatusCode)
+			}
+
+			return nil
+		},
+	}
+}
+
+func (r *Resource) waitForConditions(ctx context.Context, conditions []Condition) error {
+	for _, c := range conditions {
+		err := r.waitForCondition(ctx, c)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Resource) waitForCondition(ctx context.Context, c Condition) error {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultConditionTimeout
+	}
+
+	r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for condition %#q", c.Name))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// lastErr tracks the last error returned before the timeout expired, so
+	// that we do not report a meaningless context deadline error.
+	var lastErr error
+	o := func() error {
+		err := c.Check(ctx)
+		if err != nil && ctx.Err() == nil {
+			lastErr = err
+		}
+
+		return err
+	}
+
+	n := func(err error, t time.Duration) {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("condition %#q not met: retrying in %s", c.Name, t), "stack", fmt.Sprintf("%v", err))
+	}
+
+	b := backoff.NewExponential(timeout, backoff.ShortMaxInterval)
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil && ctx.Err() != nil && lastErr != nil {
+		return microerror.Mask(lastErr)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("condition %#q met", c.Name))
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package legacyresource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_LegacyResource_Conditions(t *testing.T) {
+	replicas := int32(2)
+
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer okServer.Close()
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failingServer.Close()
+
+	testCases := []struct {
+		name         string
+		objects      []runtime.Object
+		condition    func(c *fake.Clientset) Condition
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: deployment is ready",
+			objects: []runtime.Object{
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+					Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+					Status:     appsv1.DeploymentStatus{ReadyReplicas: 2, UpdatedReplicas: 2},
+				},
+			},
+			condition: func(c *fake.Clientset) Condition {
+				return DeploymentReady(c, "default", "app")
+			},
+		},
+		{
+			name: "case 1: deployment is not ready",
+			objects: []runtime.Object{
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+					Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+					Status:     appsv1.DeploymentStatus{ReadyReplicas: 1, UpdatedReplicas: 2},
+				},
+			},
+			condition: func(c *fake.Clientset) Condition {
+				return DeploymentReady(c, "default", "app")
+			},
+			errorMatcher: IsConditionNotMet,
+		},
+		{
+			name: "case 2: job failed",
+			objects: []runtime.Object{
+				&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "default"},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{
+							{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+						},
+					},
+				},
+			},
+			condition: func(c *fake.Clientset) Condition {
+				return JobSucceeded(c, "default", "migrate")
+			},
+			errorMatcher: IsConditionNotMet,
+		},
+		{
+			name: "case 3: endpoints have addresses",
+			objects: []runtime.Object{
+				&corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+					Subsets: []corev1.EndpointSubset{
+						{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+					},
+				},
+			},
+			condition: func(c *fake.Clientset) Condition {
+				return EndpointsHaveAddresses(c, "default", "app")
+			},
+		},
+		{
+			name: "case 4: url returns 200",
+			condition: func(c *fake.Clientset) Condition {
+				return URLReturnsOK(nil, okServer.URL)
+			},
+		},
+		{
+			name: "case 5: url returns 503",
+			condition: func(c *fake.Clientset) Condition {
+				return URLReturnsOK(nil, failingServer.URL)
+			},
+			errorMatcher: IsConditionNotMet,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			r := &Resource{
+				logger: microloggertest.New(),
+			}
+			c := tc.condition(fake.NewSimpleClientset(tc.objects...)).WithTimeout(100 * time.Millisecond)
+
+			err := r.waitForCondition(context.Background(), c)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package legacyresource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"sigs.k8s.io/yaml"
+)
+
+// ObjectKey identifies a Kubernetes object rendered by a chart. The API
+// version is not part of the key, so that moving an object to a new API
+// version shows up as a changed field instead of a removed and added object.
+type ObjectKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (k ObjectKey) String() string {
+	return fmt.Sprintf("%s/%s/%s", k.Kind, k.Namespace, k.Name)
+}
+
+// FieldChange describes a single changed field of an object.
+type FieldChange struct {
+	// Path is the dot separated path of the field, e.g. "spec.clusterIP". List
+	// items are referenced by their index, e.g. "spec.ports.0.port".
+	Path string
+	// Old is the currently installed value. It is nil for added fields.
+	Old interface{}
+	// New is the desired value. It is nil for removed fields.
+	New interface{}
+}
+
+// ObjectDiff lists the changed fields of an object existing in both the
+// installed and the desired state.
+type ObjectDiff struct {
+	Key     ObjectKey
+	Changes []FieldChange
+}
+
+// HasChange returns true if the field found at the given path or any field
+// nested below it changed.
+func (d ObjectDiff) HasChange(path string) bool {
+	for _, c := range d.Changes {
+		if c.Path == path || strings.HasPrefix(c.Path, path+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReleaseDiff is the structured difference between the installed manifest of
+// a release and the manifest rendered from the desired chart and values.
+type ReleaseDiff struct {
+	Added   []ObjectKey
+	Removed []ObjectKey
+	Changed []ObjectDiff
+}
+
+// IsEmpty returns true if applying the desired state would not change
+// anything.
+func (d ReleaseDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Object returns the diff of the object identified by the given key. The
+// second return value is false if the object did not change.
+func (d ReleaseDiff) Object(key ObjectKey) (ObjectDiff, bool) {
+	for _, o := range d.Changed {
+		if o.Key == key {
+			return o, true
+		}
+	}
+
+	return ObjectDiff{}, false
+}
+
+// Diff renders the chart found at the given URL using the given values and
+// compares the result with the manifest of the currently deployed revision of
+// the given release. Chart hooks and tests are not part of the diff.
+func (r *Resource) Diff(ctx context.Context, name, url, values string) (ReleaseDiff, error) {
+	if r.k8sClient == nil {
+		return ReleaseDiff{}, microerror.Maskf(invalidConfigError, "K8sClient must not be empty for computing diffs")
+	}
+
+	tarballPath, err := r.helmClient.PullChartTarball(ctx, url)
+	defer func() {
+		fs := afero.NewOsFs()
+		err := fs.Remove(tarballPath)
+		if err != nil {
+			r.logger.LogCtx(ctx, "level", "error", "message", "failed to delete tarball", "stack", fmt.Sprintf("%#v", err))
+		}
+	}()
+	if err != nil {
+		return ReleaseDiff{}, microerror.Mask(err)
+	}
+
+	var rawValues map[string]interface{}
+
+	err = yaml.Unmarshal([]byte(values), &rawValues)
+	if err != nil {
+		return ReleaseDiff{}, microerror.Mask(err)
+	}
+
+	var current []string
+	{
+		s := storage.Init(driver.NewSecrets(r.k8sClient.CoreV1().Secrets(r.namespace)))
+		rel, err := s.Deployed(name)
+		if errors.Is(err, driver.ErrReleaseNotFound) || errors.Is(err, driver.ErrNoDeployedReleases) {
+			return ReleaseDiff{}, microerror.Maskf(releaseNotFoundError, "%#q: %s", name, err)
+		} else if err != nil {
+			return ReleaseDiff{}, microerror.Mask(err)
+		}
+
+		for _, m := range releaseutil.SplitManifests(rel.Manifest) {
+			current = append(current, m)
+		}
+	}
+
+	var desired []string
+	{
+		chart, err := loader.Load(tarballPath)
+		if err != nil {
+			return ReleaseDiff{}, microerror.Mask(err)
+		}
+
+		var caps *chartutil.Capabilities
+		{
+			v, err := r.k8sClient.Discovery().ServerVersion()
+			if err != nil {
+				return ReleaseDiff{}, microerror.Mask(err)
+			}
+
+			// Charts may render objects depending on the API versions served
+			// by the cluster, so the version set must match a real upgrade.
+			apiVersions, err := action.GetVersionSet(r.k8sClient.Discovery())
+			if err != nil {
+				return ReleaseDiff{}, microerror.Mask(err)
+			}
+
+			caps = &chartutil.Capabilities{
+				KubeVersion: chartutil.KubeVersion{
+					Version: v.GitVersion,
+					Major:   v.Major,
+					Minor:   v.Minor,
+				},
+				APIVersions: apiVersions,
+			}
+		}
+
+		err = chartutil.ProcessDependencies(chart, rawValues)
+		if err != nil {
+			return ReleaseDiff{}, microerror.Mask(err)
+		}
+
+		options := chartutil.ReleaseOptions{
+			Name:      name,
+			Namespace: r.namespace,
+			IsUpgrade: true,
+		}
+		renderValues, err := chartutil.ToRenderValues(chart, rawValues, options, caps)
+		if err != nil {
+			return ReleaseDiff{}, microerror.Mask(err)
+		}
+
+		files, err := engine.Render(chart, renderValues)
+		if err != nil {
+			return ReleaseDiff{}, microerror.Mask(err)
+		}
+
+		for f := range files {
+			if strings.HasSuffix(f, "NOTES.txt") {
+				delete(files, f)
+			}
+		}
+
+		_, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+		if err != nil {
+			return ReleaseDiff{}, microerror.Mask(err)
+		}
+
+		for _, m := range manifests {
+			desired = append(desired, m.Content)
+		}
+	}
+
+	d, err := diffManifests(r.namespace, current, desired)
+	if err != nil {
+		return ReleaseDiff{}, microerror.Mask(err)
+	}
+
+	return d, nil
+}
+
+func diffManifests(namespace string, current, desired []string) (ReleaseDiff, error) {
+	currentObjects, err := parseManifests(namespace, current)
+	if err != nil {
+		return ReleaseDiff{}, microerror.Mask(err)
+	}
+	desiredObjects, err := parseManifests(namespace, desired)
+	if err != nil {
+		return ReleaseDiff{}, microerror.Mask(err)
+	}
+
+	var d ReleaseDiff
+
+	for k, desiredObject := range desiredObjects {
+		currentObject, ok := currentObjects[k]
+		if !ok {
+			d.Added = append(d.Added, k)
+			continue
+		}
+
+		var changes []FieldChange
+		diffFields("", currentObject, desiredObject, &changes)
+		if len(changes) > 0 {
+			sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+			d.Changed = append(d.Changed, ObjectDiff{Key: k, Changes: changes})
+		}
+	}
+
+	for k := range currentObjects {
+		_, ok := desiredObjects[k]
+		if !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].String() < d.Added[j].String() })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].String() < d.Removed[j].String() })
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Key.String() < d.Changed[j].Key.String() })
+
+	return d, nil
+}
+
+func diffFields(path string, current, desired interface{}, changes *[]FieldChange) {
+	currentMap, currentIsMap := current.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if currentIsMap && desiredIsMap {
+		for k, v := range desiredMap {
+			diffFields(joinFieldPath(path, k), currentMap[k], v, changes)
+		}
+		for k, v := range currentMap {
+			_, ok := desiredMap[k]
+			if !ok {
+				diffFields(joinFieldPath(path, k), v, nil, changes)
+			}
+		}
+		return
+	}
+
+	currentList, currentIsList := current.([]interface{})
+	desiredList, desiredIsList := desired.([]interface{})
+	if currentIsList && desiredIsList {
+		for i := 0; i < len(currentList) || i < len(desiredList); i++ {
+			var c, d interface{}
+			if i < len(currentList) {
+				c = currentList[i]
+			}
+			if i < len(desiredList) {
+				d = desiredList[i]
+			}
+			diffFields(joinFieldPath(path, strconv.Itoa(i)), c, d, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(current, desired) {
+		*changes = append(*changes, FieldChange{Path: path, Old: current, New: desired})
+	}
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return path + "." + field
+}
+
+func parseManifests(namespace string, manifests []string) (map[ObjectKey]map[string]interface{}, error) {
+	objects := map[ObjectKey]map[string]interface{}{}
+
+	for _, m := range manifests {
+		var o map[string]interface{}
+		err := yaml.Unmarshal([]byte(m), &o)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		// Skip empty documents.
+		if len(o) == 0 {
+			continue
+		}
+
+		var key ObjectKey
+		{
+			key.Kind, _ = o["kind"].(string)
+
+			metadata, _ := o["metadata"].(map[string]interface{})
+			key.Name, _ = metadata["name"].(string)
+			key.Namespace, _ = metadata["namespace"].(string)
+			if key.Namespace == "" {
+				key.Namespace = namespace
+			}
+		}
+
+		_, ok := objects[key]
+		if ok {
+			return nil, microerror.Maskf(duplicateObjectError, "%s rendered twice", key)
+		}
+
+		objects[key] = o
+	}
+
+	return objects, nil
+}
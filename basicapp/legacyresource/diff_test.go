@@ -0,0 +1,345 @@
+package legacyresource
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/helmclient/v2/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	diffTestService        = "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  ports:\n  - port: 80\n"
+	diffTestServiceMonitor = "apiVersion: monitoring.coreos.com/v1\nkind: ServiceMonitor\nmetadata:\n  name: app\n"
+)
+
+func Test_LegacyResource_Diff(t *testing.T) {
+	testCases := []struct {
+		name string
+		// apiVersions are served by the fake cluster in addition to v1.
+		apiVersions []string
+		// manifest is the manifest of the deployed release. No release is
+		// deployed if it is empty.
+		manifest string
+		// listErr is returned when listing release secrets.
+		listErr      error
+		values       string
+		expectedDiff ReleaseDiff
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: no changes with capability dependent object",
+			apiVersions:  []string{"monitoring.coreos.com/v1"},
+			manifest:     "---\n" + diffTestService + "---\n" + diffTestServiceMonitor,
+			expectedDiff: ReleaseDiff{},
+		},
+		{
+			name:        "case 1: changed values",
+			apiVersions: []string{"monitoring.coreos.com/v1"},
+			manifest:    "---\n" + diffTestService + "---\n" + diffTestServiceMonitor,
+			values:      "port: 443",
+			expectedDiff: ReleaseDiff{
+				Changed: []ObjectDiff{
+					{
+						Key: ObjectKey{Kind: "Service", Namespace: "default", Name: "app"},
+						Changes: []FieldChange{
+							{Path: "spec.ports.0.port", Old: float64(80), New: float64(443)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "case 2: api version no longer served by the cluster",
+			manifest: "---\n" + diffTestService + "---\n" + diffTestServiceMonitor,
+			expectedDiff: ReleaseDiff{
+				Removed: []ObjectKey{
+					{Kind: "ServiceMonitor", Namespace: "default", Name: "app"},
+				},
+			},
+		},
+		{
+			name:         "case 3: release is not deployed",
+			errorMatcher: IsReleaseNotFound,
+		},
+		{
+			name:    "case 4: release secrets cannot be listed",
+			listErr: apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("rbac")),
+			errorMatcher: func(err error) bool {
+				return !IsReleaseNotFound(err)
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "legacyresource")
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			tarballPath, err := chartutil.Save(diffTestChart(), dir)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			k8sClient := fake.NewSimpleClientset()
+			{
+				resources := []*metav1.APIResourceList{
+					{
+						GroupVersion: "v1",
+						APIResources: []metav1.APIResource{{Name: "services", Kind: "Service", Namespaced: true}},
+					},
+				}
+				for _, v := range tc.apiVersions {
+					resources = append(resources, &metav1.APIResourceList{GroupVersion: v})
+				}
+				k8sClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = resources
+			}
+
+			if tc.manifest != "" {
+				s := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+				err = s.Create(&release.Release{
+					Name:      "app",
+					Namespace: "default",
+					Version:   1,
+					Info:      &release.Info{Status: release.StatusDeployed},
+					Manifest:  tc.manifest,
+				})
+				if err != nil {
+					t.Fatalf("unexpected error %#v", err)
+				}
+			}
+
+			if tc.listErr != nil {
+				k8sClient.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tc.listErr
+				})
+			}
+
+			r := &Resource{
+				helmClient: helmclienttest.New(helmclienttest.Config{PullChartTarballPath: tarballPath}),
+				k8sClient:  k8sClient,
+				logger:     microloggertest.New(),
+
+				namespace: "default",
+			}
+
+			d, err := r.Diff(context.Background(), "app", "https://example.com/app-0.1.0.tgz", tc.values)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(d, tc.expectedDiff) {
+				t.Fatalf("%s: diff == %#v, want %#v", tc.name, d, tc.expectedDiff)
+			}
+		})
+	}
+}
+
+func Test_LegacyResource_diffManifests(t *testing.T) {
+	testCases := []struct {
+		name         string
+		current      []string
+		desired      []string
+		expectedDiff ReleaseDiff
+	}{
+		{
+			name: "case 0: no changes",
+			current: []string{
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 172.31.0.10\n",
+			},
+			desired: []string{
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 172.31.0.10\n",
+			},
+			expectedDiff: ReleaseDiff{},
+		},
+		{
+			name: "case 1: changed, added and removed objects",
+			current: []string{
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 172.31.0.10\n  ports:\n  - port: 80\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: old\n",
+			},
+			desired: []string{
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  ports:\n  - port: 80\n  - port: 443\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: new\n  namespace: other\n",
+			},
+			expectedDiff: ReleaseDiff{
+				Added: []ObjectKey{
+					{Kind: "ConfigMap", Namespace: "other", Name: "new"},
+				},
+				Removed: []ObjectKey{
+					{Kind: "ConfigMap", Namespace: "default", Name: "old"},
+				},
+				Changed: []ObjectDiff{
+					{
+						Key: ObjectKey{Kind: "Service", Namespace: "default", Name: "app"},
+						Changes: []FieldChange{
+							{Path: "spec.clusterIP", Old: "172.31.0.10", New: nil},
+							{Path: "spec.ports.1", Old: nil, New: map[string]interface{}{"port": float64(443)}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "case 2: api version changes do not recreate objects",
+			current: []string{
+				"apiVersion: apps/v1beta2\nkind: StatefulSet\nmetadata:\n  name: db\n",
+			},
+			desired: []string{
+				"apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: db\n",
+			},
+			expectedDiff: ReleaseDiff{
+				Changed: []ObjectDiff{
+					{
+						Key: ObjectKey{Kind: "StatefulSet", Namespace: "default", Name: "db"},
+						Changes: []FieldChange{
+							{Path: "apiVersion", Old: "apps/v1beta2", New: "apps/v1"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d, err := diffManifests("default", tc.current, tc.desired)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !reflect.DeepEqual(d, tc.expectedDiff) {
+				t.Fatalf("diff == %#v, want %#v", d, tc.expectedDiff)
+			}
+		})
+	}
+}
+
+func Test_LegacyResource_parseManifests(t *testing.T) {
+	testCases := []struct {
+		name            string
+		manifests       []string
+		expectedObjects []ObjectKey
+		errorMatcher    func(error) bool
+	}{
+		{
+			name: "case 0: namespace defaults to release namespace",
+			manifests: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n  namespace: other\n",
+			},
+			expectedObjects: []ObjectKey{
+				{Kind: "ConfigMap", Namespace: "default", Name: "a"},
+				{Kind: "ConfigMap", Namespace: "other", Name: "b"},
+			},
+		},
+		{
+			name: "case 1: empty documents are skipped",
+			manifests: []string{
+				"",
+				"# Source: app/templates/empty.yaml\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+			},
+			expectedObjects: []ObjectKey{
+				{Kind: "ConfigMap", Namespace: "default", Name: "a"},
+			},
+		},
+		{
+			name: "case 2: duplicate objects",
+			manifests: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\ndata:\n  key: one\n",
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: default\ndata:\n  key: two\n",
+			},
+			errorMatcher: IsDuplicateObject,
+		},
+		{
+			name: "case 3: invalid yaml",
+			manifests: []string{
+				"kind: [ConfigMap\n",
+			},
+			errorMatcher: func(err error) bool {
+				return err != nil
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			objects, err := parseManifests("default", tc.manifests)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if len(objects) != len(tc.expectedObjects) {
+				t.Fatalf("%s: objects == %d, want %d", tc.name, len(objects), len(tc.expectedObjects))
+			}
+			for _, k := range tc.expectedObjects {
+				_, ok := objects[k]
+				if !ok {
+					t.Fatalf("%s: object %s not found", tc.name, k)
+				}
+			}
+		})
+	}
+}
+
+// diffTestChart renders a service using the port value and a service monitor
+// if the cluster serves the monitoring API.
+func diffTestChart() *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       "app",
+			Version:    "0.1.0",
+		},
+		Templates: []*chart.File{
+			{
+				Name: "templates/service.yaml",
+				Data: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  ports:\n  - port: {{ .Values.port }}\n"),
+			},
+			{
+				Name: "templates/servicemonitor.yaml",
+				Data: []byte("{{- if .Capabilities.APIVersions.Has \"monitoring.coreos.com/v1\" }}\n" + diffTestServiceMonitor + "{{- end }}\n"),
+			},
+		},
+		// Raw holds the values file written by chartutil.Save.
+		Raw: []*chart.File{
+			{
+				Name: chartutil.ValuesfileName,
+				Data: []byte("port: 80\n"),
+			},
+		},
+	}
+}
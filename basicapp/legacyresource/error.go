@@ -46,3 +46,57 @@ var tillerNotFoundError = &microerror.Error{
 func IsTillerNotFound(err error) bool {
 	return microerror.Cause(err) == tillerNotFoundError
 }
+
+var envVarNotFoundError = &microerror.Error{
+	Kind: "envVarNotFoundError",
+}
+
+// IsEnvVarNotFound asserts envVarNotFoundError.
+func IsEnvVarNotFound(err error) bool {
+	return microerror.Cause(err) == envVarNotFoundError
+}
+
+var invalidValuesError = &microerror.Error{
+	Kind: "invalidValuesError",
+}
+
+// IsInvalidValues asserts invalidValuesError.
+func IsInvalidValues(err error) bool {
+	return microerror.Cause(err) == invalidValuesError
+}
+
+var namespaceNotDeletedError = &microerror.Error{
+	Kind: "namespaceNotDeletedError",
+}
+
+// IsNamespaceNotDeleted asserts namespaceNotDeletedError.
+func IsNamespaceNotDeleted(err error) bool {
+	return microerror.Cause(err) == namespaceNotDeletedError
+}
+
+var conditionNotMetError = &microerror.Error{
+	Kind: "conditionNotMetError",
+}
+
+// IsConditionNotMet asserts conditionNotMetError.
+func IsConditionNotMet(err error) bool {
+	return microerror.Cause(err) == conditionNotMetError
+}
+
+var dependencyCycleError = &microerror.Error{
+	Kind: "dependencyCycleError",
+}
+
+// IsDependencyCycle asserts dependencyCycleError.
+func IsDependencyCycle(err error) bool {
+	return microerror.Cause(err) == dependencyCycleError
+}
+
+var duplicateObjectError = &microerror.Error{
+	Kind: "duplicateObjectError",
+}
+
+// IsDuplicateObject asserts duplicateObjectError.
+func IsDuplicateObject(err error) bool {
+	return microerror.Cause(err) == duplicateObjectError
+}
@@ -0,0 +1,153 @@
+package legacyresource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// managedByLabel marks namespaces created by the Resource. Only namespaces
+	// carrying this label are deleted again.
+	managedByLabel = "giantswarm.io/managed-by"
+	managedByValue = "e2etests"
+)
+
+// NamespaceConfig configures the lifecycle of the namespace releases are
+// installed to.
+type NamespaceConfig struct {
+	// Create enables creating the namespace before installing a release and
+	// deleting it when the last release in it is deleted using EnsureDeleted.
+	// Namespaces which already existed are never deleted.
+	Create bool
+	// Annotations are set on the namespace when it is created.
+	Annotations map[string]string
+	// Labels are set on the namespace when it is created, e.g. pod security or
+	// network policy labels.
+	Labels map[string]string
+}
+
+func (r *Resource) ensureNamespaceCreated(ctx context.Context) error {
+	r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ensuring creation of namespace %#q", r.namespace))
+
+	ns, err := r.k8sClient.CoreV1().Namespaces().Get(ctx, r.namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Fall through.
+	} else if err != nil {
+		return microerror.Mask(err)
+	} else if ns.Status.Phase == corev1.NamespaceTerminating {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("namespace %#q is terminating", r.namespace))
+
+		err = r.waitForNamespaceDeleted(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	} else {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("namespace %#q already exists", r.namespace))
+		return nil
+	}
+
+	labels := map[string]string{}
+	for k, v := range r.namespaceConfig.Labels {
+		labels[k] = v
+	}
+	labels[managedByLabel] = managedByValue
+
+	ns = &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.namespace,
+			Annotations: r.namespaceConfig.Annotations,
+			Labels:      labels,
+		},
+	}
+
+	_, err = r.k8sClient.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("namespace %#q already exists", r.namespace))
+	} else if err != nil {
+		return microerror.Mask(err)
+	} else {
+		r.logger.LogCtx(ctx, "level", "info", "message", fmt.Sprintf("created namespace %#q", r.namespace))
+	}
+
+	r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ensured creation of namespace %#q", r.namespace))
+
+	return nil
+}
+
+func (r *Resource) ensureNamespaceDeleted(ctx context.Context) error {
+	r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ensuring deletion of namespace %#q", r.namespace))
+
+	ns, err := r.k8sClient.CoreV1().Namespaces().Get(ctx, r.namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("namespace %#q does not exist", r.namespace))
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if ns.Labels[managedByLabel] != managedByValue {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("not deleting namespace %#q because it was not created by us", r.namespace))
+		return nil
+	}
+
+	releases, err := r.helmClient.ListReleaseContents(ctx, r.namespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if len(releases) > 0 {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("not deleting namespace %#q because it still contains %d releases", r.namespace, len(releases)))
+		return nil
+	}
+
+	if ns.Status.Phase != corev1.NamespaceTerminating {
+		err = r.k8sClient.CoreV1().Namespaces().Delete(ctx, r.namespace, metav1.DeleteOptions{})
+		if apierrors.IsNotFound(err) {
+			// Fall through.
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	err = r.waitForNamespaceDeleted(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.LogCtx(ctx, "level", "info", "message", fmt.Sprintf("deleted namespace %#q", r.namespace))
+
+	return nil
+}
+
+// waitForNamespaceDeleted waits for the namespace to finish terminating, so
+// that subsequent tests do not collide on a terminating namespace.
+func (r *Resource) waitForNamespaceDeleted(ctx context.Context) error {
+	o := func() error {
+		_, err := r.k8sClient.CoreV1().Namespaces().Get(ctx, r.namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return microerror.Maskf(namespaceNotDeletedError, "namespace %#q is still terminating", r.namespace)
+	}
+
+	n := func(err error, t time.Duration) {
+		r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for namespace %#q to be deleted: retrying in %s", r.namespace, t))
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package legacyresource
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/helmclient/v2/pkg/helmclient"
+	"github.com/giantswarm/helmclient/v2/pkg/helmclienttest"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var errListReleasesFailed = errors.New("list releases failed")
+
+// helmClientFake returns the configured releases when listing release
+// contents. All other calls are served by helmclienttest.
+type helmClientFake struct {
+	helmclient.Interface
+
+	releases []*helmclient.ReleaseContent
+	err      error
+}
+
+func (h *helmClientFake) ListReleaseContents(ctx context.Context, namespace string) ([]*helmclient.ReleaseContent, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	return h.releases, nil
+}
+
+// terminateOnSecondGet removes terminating namespaces from the tracker once
+// they are read for the second time, so that waiting for their deletion ends.
+func terminateOnSecondGet(c *fake.Clientset) {
+	var gets int
+	c.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets < 2 {
+			return false, nil, nil
+		}
+
+		name := action.(k8stesting.GetAction).GetName()
+		obj, err := c.Tracker().Get(corev1.SchemeGroupVersion.WithResource("namespaces"), "", name)
+		if err != nil {
+			return false, nil, nil
+		}
+		if obj.(*corev1.Namespace).Status.Phase == corev1.NamespaceTerminating {
+			_ = c.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("namespaces"), "", name)
+		}
+
+		return false, nil, nil
+	})
+}
+
+func Test_LegacyResource_ensureNamespaceCreated(t *testing.T) {
+	testCases := []struct {
+		name            string
+		objects         []runtime.Object
+		namespaceConfig NamespaceConfig
+		expectedLabels  map[string]string
+		errorMatcher    func(error) bool
+	}{
+		{
+			name: "case 0: namespace is created with managed-by label",
+			namespaceConfig: NamespaceConfig{
+				Create: true,
+				Labels: map[string]string{"team": "batman"},
+			},
+			expectedLabels: map[string]string{
+				managedByLabel: managedByValue,
+				"team":         "batman",
+			},
+		},
+		{
+			name: "case 1: existing namespace is kept as is",
+			objects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "robin"}},
+				},
+			},
+			namespaceConfig: NamespaceConfig{
+				Create: true,
+				Labels: map[string]string{"team": "batman"},
+			},
+			expectedLabels: map[string]string{"team": "robin"},
+		},
+		{
+			name: "case 2: terminating namespace is recreated",
+			objects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "robin"}},
+					Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+				},
+			},
+			namespaceConfig: NamespaceConfig{
+				Create: true,
+			},
+			expectedLabels: map[string]string{managedByLabel: managedByValue},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			k8sClient := fake.NewSimpleClientset(tc.objects...)
+			terminateOnSecondGet(k8sClient)
+
+			r := &Resource{
+				helmClient: &helmClientFake{Interface: helmclienttest.New(helmclienttest.Config{})},
+				k8sClient:  k8sClient,
+				logger:     microloggertest.New(),
+
+				namespace:       "test",
+				namespaceConfig: tc.namespaceConfig,
+			}
+
+			err := r.ensureNamespaceCreated(ctx)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			ns, err := k8sClient.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+			if !reflect.DeepEqual(ns.Labels, tc.expectedLabels) {
+				t.Fatalf("%s: labels == %#v, want %#v", tc.name, ns.Labels, tc.expectedLabels)
+			}
+		})
+	}
+}
+
+func Test_LegacyResource_ensureNamespaceDeleted(t *testing.T) {
+	managedNamespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{managedByLabel: managedByValue}},
+	}
+
+	testCases := []struct {
+		name            string
+		objects         []runtime.Object
+		releases        []*helmclient.ReleaseContent
+		listErr         error
+		expectedDeleted bool
+		errorMatcher    func(error) bool
+	}{
+		{
+			name:            "case 0: missing namespace",
+			expectedDeleted: true,
+		},
+		{
+			name: "case 1: namespace not created by us is kept",
+			objects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				},
+			},
+			expectedDeleted: false,
+		},
+		{
+			name: "case 2: namespace with other managed-by value is kept",
+			objects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{managedByLabel: "someone-else"}},
+				},
+			},
+			expectedDeleted: false,
+		},
+		{
+			name:    "case 3: namespace with remaining releases is kept",
+			objects: []runtime.Object{managedNamespace.DeepCopy()},
+			releases: []*helmclient.ReleaseContent{
+				{Name: "other-release"},
+			},
+			expectedDeleted: false,
+		},
+		{
+			name:            "case 4: managed namespace without releases is deleted",
+			objects:         []runtime.Object{managedNamespace.DeepCopy()},
+			expectedDeleted: true,
+		},
+		{
+			name: "case 5: terminating managed namespace is waited for",
+			objects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{managedByLabel: managedByValue}},
+					Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+				},
+			},
+			expectedDeleted: true,
+		},
+		{
+			name:            "case 6: listing releases fails",
+			objects:         []runtime.Object{managedNamespace.DeepCopy()},
+			listErr:         errListReleasesFailed,
+			expectedDeleted: false,
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errListReleasesFailed
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			k8sClient := fake.NewSimpleClientset(tc.objects...)
+			terminateOnSecondGet(k8sClient)
+
+			r := &Resource{
+				helmClient: &helmClientFake{
+					Interface: helmclienttest.New(helmclienttest.Config{}),
+
+					releases: tc.releases,
+					err:      tc.listErr,
+				},
+				k8sClient: k8sClient,
+				logger:    microloggertest.New(),
+
+				namespace:       "test",
+				namespaceConfig: NamespaceConfig{Create: true},
+			}
+
+			err := r.ensureNamespaceDeleted(ctx)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			_, err = k8sClient.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+			if tc.expectedDeleted && !apierrors.IsNotFound(err) {
+				t.Fatalf("%s: namespace error == %#v, want not found", tc.name, err)
+			}
+			if !tc.expectedDeleted && err != nil {
+				t.Fatalf("%s: namespace error == %#v, want nil", tc.name, err)
+			}
+		})
+	}
+}
+
+func Test_LegacyResource_waitForNamespaceDeleted(t *testing.T) {
+	testCases := []struct {
+		name    string
+		objects []runtime.Object
+	}{
+		{
+			name: "case 0: namespace does not exist",
+		},
+		{
+			name: "case 1: namespace finishes terminating",
+			objects: []runtime.Object{
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "test"},
+					Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(tc.objects...)
+			terminateOnSecondGet(k8sClient)
+
+			r := &Resource{
+				k8sClient: k8sClient,
+				logger:    microloggertest.New(),
+
+				namespace: "test",
+			}
+
+			err := r.waitForNamespaceDeleted(context.Background())
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+		})
+	}
+}
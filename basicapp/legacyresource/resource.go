@@ -10,6 +10,7 @@ import (
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"github.com/spf13/afero"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/yaml"
 )
 
@@ -19,16 +20,22 @@ const (
 
 type Config struct {
 	HelmClient *helmclient.Client
-	Logger     micrologger.Logger
+	// K8sClient is only required when NamespaceConfig.Create is set or Diff
+	// is used.
+	K8sClient kubernetes.Interface
+	Logger    micrologger.Logger
 
-	Namespace string
+	Namespace       string
+	NamespaceConfig NamespaceConfig
 }
 
 type Resource struct {
-	helmClient *helmclient.Client
+	helmClient helmclient.Interface
+	k8sClient  kubernetes.Interface
 	logger     micrologger.Logger
 
-	namespace string
+	namespace       string
+	namespaceConfig NamespaceConfig
 }
 
 func New(config Config) (*Resource, error) {
@@ -38,14 +45,20 @@ func New(config Config) (*Resource, error) {
 	if config.HelmClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.HelmClient must not be empty", config)
 	}
+	if config.NamespaceConfig.Create && config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty when %T.Create is set", config, config.NamespaceConfig)
+	}
+
 	if config.Namespace == "" {
 		config.Namespace = defaultNamespace
 	}
 	c := &Resource{
 		helmClient: config.HelmClient,
+		k8sClient:  config.K8sClient,
 		logger:     config.Logger,
 
-		namespace: config.Namespace,
+		namespace:       config.Namespace,
+		namespaceConfig: config.NamespaceConfig,
 	}
 
 	return c, nil
@@ -76,14 +89,30 @@ func (r *Resource) EnsureDeleted(ctx context.Context, name string) error {
 		r.logger.LogCtx(ctx, "level", "info", "message", fmt.Sprintf("deleted release %#q", name))
 	}
 
+	if r.namespaceConfig.Create {
+		err = r.ensureNamespaceDeleted(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
 	r.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ensured deletion of release %#q", name))
 
 	return nil
 }
 
-func (r *Resource) Install(name, url, values string, conditions ...func() error) error {
+// Install installs the chart found at the given URL using the given values and
+// waits for the given conditions to be met afterwards.
+func (r *Resource) Install(name, url, values string, conditions ...Condition) error {
 	ctx := context.TODO()
 
+	if r.namespaceConfig.Create {
+		err := r.ensureNamespaceCreated(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
 	tarballPath, err := r.helmClient.PullChartTarball(ctx, url)
 	defer func() {
 		fs := afero.NewOsFs()
@@ -112,17 +141,17 @@ func (r *Resource) Install(name, url, values string, conditions ...func() error)
 		return microerror.Mask(err)
 	}
 
-	for _, c := range conditions {
-		err = backoff.Retry(c, backoff.NewExponential(backoff.ShortMaxWait, backoff.ShortMaxInterval))
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	err = r.waitForConditions(ctx, conditions)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
 	return nil
 }
 
-func (r *Resource) Update(name, url, values string, conditions ...func() error) error {
+// Update updates the release to the chart found at the given URL using the
+// given values and waits for the given conditions to be met afterwards.
+func (r *Resource) Update(name, url, values string, conditions ...Condition) error {
 	ctx := context.TODO()
 
 	tarballPath, err := r.helmClient.PullChartTarball(ctx, url)
@@ -152,6 +181,11 @@ func (r *Resource) Update(name, url, values string, conditions ...func() error)
 		return microerror.Mask(err)
 	}
 
+	err = r.waitForConditions(ctx, conditions)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,258 @@
+package legacyresource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+)
+
+type ValuesBuilderConfig struct {
+	// Fs is used to read values files. Defaults to the OS filesystem.
+	Fs     afero.Fs
+	Logger micrologger.Logger
+}
+
+// ValuesBuilder composes chart values from ordered layers. Layers added later
+// take precedence over layers added earlier. Nested maps are merged
+// recursively, all other values are replaced. A null value in a later layer
+// removes the key from the result, the same way Helm treats null overrides.
+type ValuesBuilder struct {
+	fs     afero.Fs
+	logger micrologger.Logger
+
+	layers []valuesLayer
+}
+
+type valuesLayer struct {
+	// description is logged when the layer is merged. It must never contain
+	// secret values.
+	description string
+	load        func() (map[string]interface{}, error)
+}
+
+func NewValuesBuilder(config ValuesBuilderConfig) (*ValuesBuilder, error) {
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+	if config.Fs == nil {
+		config.Fs = afero.NewOsFs()
+	}
+
+	v := &ValuesBuilder{
+		fs:     config.Fs,
+		logger: config.Logger,
+	}
+
+	return v, nil
+}
+
+// AddEnv sets the value found at the given dot separated path to the content
+// of the given environment variable. It is meant for secrets, so the value is
+// never logged. Build fails when the environment variable is not set.
+func (v *ValuesBuilder) AddEnv(path, env string) *ValuesBuilder {
+	v.layers = append(v.layers, valuesLayer{
+		description: fmt.Sprintf("environment variable %#q at %#q", env, path),
+		load: func() (map[string]interface{}, error) {
+			value, ok := os.LookupEnv(env)
+			if !ok {
+				return nil, microerror.Maskf(envVarNotFoundError, "%#q", env)
+			}
+
+			values := map[string]interface{}{}
+			setPath(values, strings.Split(path, "."), value)
+
+			return values, nil
+		},
+	})
+
+	return v
+}
+
+// AddFile adds the YAML values file found at the given path.
+func (v *ValuesBuilder) AddFile(path string) *ValuesBuilder {
+	v.layers = append(v.layers, valuesLayer{
+		description: fmt.Sprintf("file %#q", path),
+		load: func() (map[string]interface{}, error) {
+			b, err := afero.ReadFile(v.fs, path)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			values, err := unmarshalValues(b)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			return values, nil
+		},
+	})
+
+	return v
+}
+
+// AddMap adds the given values. The map is copied when Build is called, so
+// later modifications of the map by the caller are still respected.
+func (v *ValuesBuilder) AddMap(name string, values map[string]interface{}) *ValuesBuilder {
+	v.layers = append(v.layers, valuesLayer{
+		description: fmt.Sprintf("map %#q", name),
+		load: func() (map[string]interface{}, error) {
+			return copyValues(values), nil
+		},
+	})
+
+	return v
+}
+
+// AddSet adds values using the syntax of Helm's --set flag, e.g.
+// "image.tag=1.2.3,replicas=2".
+func (v *ValuesBuilder) AddSet(set string) *ValuesBuilder {
+	v.layers = append(v.layers, valuesLayer{
+		description: fmt.Sprintf("set %#q", set),
+		load: func() (map[string]interface{}, error) {
+			values, err := strvals.Parse(set)
+			if err != nil {
+				return nil, microerror.Maskf(invalidValuesError, "%#q: %s", set, err)
+			}
+
+			return values, nil
+		},
+	})
+
+	return v
+}
+
+// AddYAML adds the given YAML document. The name is used for logging only.
+func (v *ValuesBuilder) AddYAML(name, values string) *ValuesBuilder {
+	v.layers = append(v.layers, valuesLayer{
+		description: fmt.Sprintf("yaml %#q", name),
+		load: func() (map[string]interface{}, error) {
+			m, err := unmarshalValues([]byte(values))
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			return m, nil
+		},
+	})
+
+	return v
+}
+
+// Build merges all layers in the order they were added and returns the final
+// values.
+func (v *ValuesBuilder) Build(ctx context.Context) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+
+	for _, l := range v.layers {
+		v.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("merging values from %s", l.description))
+
+		values, err := l.load()
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		mergeValues(merged, values)
+	}
+
+	return merged, nil
+}
+
+// BuildYAML works like Build but returns the final values as YAML document,
+// as expected by Resource.Install and Resource.Update.
+func (v *ValuesBuilder) BuildYAML(ctx context.Context) (string, error) {
+	values, err := v.Build(ctx)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return string(b), nil
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+// mergeValues merges src into dst. Nested maps are merged recursively, all
+// other values of src replace the ones of dst. Nil values of src remove the
+// key from dst.
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+
+		srcMap, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = copyValue(v)
+			continue
+		}
+
+		dstMap, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dstMap = map[string]interface{}{}
+			dst[k] = dstMap
+		}
+		mergeValues(dstMap, srcMap)
+	}
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyValues(t)
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i := range t {
+			c[i] = copyValue(t[i])
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+func setPath(values map[string]interface{}, path []string, value interface{}) {
+	for _, p := range path[:len(path)-1] {
+		next, ok := values[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[p] = next
+		}
+		values = next
+	}
+
+	values[path[len(path)-1]] = value
+}
+
+func unmarshalValues(b []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	err := yaml.Unmarshal(b, &values)
+	if err != nil {
+		return nil, microerror.Maskf(invalidValuesError, "%s", err)
+	}
+
+	// An empty document unmarshals into a nil map.
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,133 @@
+package legacyresource
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/spf13/afero"
+)
+
+func Test_LegacyResource_ValuesBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name           string
+		files          map[string]string
+		env            map[string]string
+		build          func(v *ValuesBuilder)
+		expectedValues map[string]interface{}
+		errorMatcher   func(error) bool
+	}{
+		{
+			name: "case 0: later layers override earlier layers",
+			build: func(v *ValuesBuilder) {
+				v.AddYAML("defaults", "image:\n  name: app\n  tag: 1.0.0\nreplicas: 1\n")
+				v.AddYAML("provider", "image:\n  tag: 1.1.0\n")
+				v.AddSet("replicas=3")
+			},
+			expectedValues: map[string]interface{}{
+				"image": map[string]interface{}{
+					"name": "app",
+					"tag":  "1.1.0",
+				},
+				"replicas": int64(3),
+			},
+		},
+		{
+			name: "case 1: files, maps and null overrides",
+			files: map[string]string{
+				"/values.yaml": "ingress:\n  enabled: true\n  host: example.com\n",
+			},
+			build: func(v *ValuesBuilder) {
+				v.AddFile("/values.yaml")
+				v.AddMap("test", map[string]interface{}{
+					"ingress": map[string]interface{}{
+						"host": nil,
+					},
+					"debug": true,
+				})
+			},
+			expectedValues: map[string]interface{}{
+				"debug": true,
+				"ingress": map[string]interface{}{
+					"enabled": true,
+				},
+			},
+		},
+		{
+			name: "case 2: environment variables are set at the given path",
+			env: map[string]string{
+				"E2E_TEST_TOKEN": "secret",
+			},
+			build: func(v *ValuesBuilder) {
+				v.AddYAML("defaults", "auth:\n  user: admin\n")
+				v.AddEnv("auth.token", "E2E_TEST_TOKEN")
+			},
+			expectedValues: map[string]interface{}{
+				"auth": map[string]interface{}{
+					"token": "secret",
+					"user":  "admin",
+				},
+			},
+		},
+		{
+			name: "case 3: missing environment variables fail",
+			build: func(v *ValuesBuilder) {
+				v.AddEnv("auth.token", "E2E_TEST_MISSING")
+			},
+			errorMatcher: IsEnvVarNotFound,
+		},
+		{
+			name: "case 4: invalid yaml fails",
+			build: func(v *ValuesBuilder) {
+				v.AddYAML("broken", "foo: [")
+			},
+			errorMatcher: IsInvalidValues,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			for path, content := range tc.files {
+				err := afero.WriteFile(fs, path, []byte(content), 0644)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+			}
+
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			c := ValuesBuilderConfig{
+				Fs:     fs,
+				Logger: microloggertest.New(),
+			}
+			v, err := NewValuesBuilder(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			tc.build(v)
+
+			values, err := v.Build(context.Background())
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if tc.errorMatcher == nil && !reflect.DeepEqual(values, tc.expectedValues) {
+				t.Fatalf("values == %#v, want %#v", values, tc.expectedValues)
+			}
+		})
+	}
+}
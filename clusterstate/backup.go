@@ -0,0 +1,139 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	postBackupConfigMapName = "post-backup"
+	// postBackupSentinelName is the sentinel config map modified after the
+	// backup was taken.
+	postBackupSentinelName = "sentinel-0"
+)
+
+// backupAndRestoreEtcd backs up the tenant cluster etcd, mutates the cluster
+// state, restores the backup and ensures that the cluster state matches the
+// backup point again. A sentinel config map is modified and a new config map
+// is created after the backup. The restore must revert both, which is verified
+// by checking the new config map is absent and running the given check, which
+// is expected to verify the sentinel objects.
+func (c *ClusterState) backupAndRestoreEtcd(ctx context.Context, check func(ctx context.Context) error) error {
+	var err error
+
+	var backupID string
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "backing up etcd")
+
+		backupID, err = c.provider.BackupEtcd(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("backed up etcd with backup %#q", backupID))
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "mutating cluster state")
+
+		err = c.mutateAfterBackup(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "mutated cluster state")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("restoring etcd backup %#q", backupID))
+
+		err = c.provider.RestoreEtcd(ctx, backupID)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("restored etcd backup %#q", backupID))
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for guest cluster")
+
+		err = c.legacyFramework.WaitForGuestReady(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "guest cluster ready")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking objects created after the backup are absent")
+
+		_, err = c.k8sClient.K8sClient().CoreV1().ConfigMaps(sentinelNamespace).Get(ctx, postBackupConfigMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Fall through.
+		} else if err != nil {
+			return microerror.Mask(err)
+		} else {
+			return microerror.Maskf(restoreMismatchError, "configmap %#q created after backup %#q still exists", postBackupConfigMapName, backupID)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "objects created after the backup are absent")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking cluster state")
+
+		err = check(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cluster state is intact")
+	}
+
+	return nil
+}
+
+func (c *ClusterState) mutateAfterBackup(ctx context.Context) error {
+	{
+		cm, err := c.k8sClient.K8sClient().CoreV1().ConfigMaps(sentinelNamespace).Get(ctx, postBackupSentinelName, metav1.GetOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		cm.Data = map[string]string{
+			"sentinel": rand.String(64),
+		}
+
+		_, err = c.k8sClient.K8sClient().CoreV1().ConfigMaps(sentinelNamespace).Update(ctx, cm, metav1.UpdateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      postBackupConfigMapName,
+				Namespace: sentinelNamespace,
+			},
+			Data: map[string]string{
+				"sentinel": rand.String(64),
+			},
+		}
+
+		_, err := c.k8sClient.K8sClient().CoreV1().ConfigMaps(sentinelNamespace).Create(ctx, cm, metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package clusterstate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+var errRestoreFailed = errors.New("restore failed")
+
+func Test_ClusterState_backupAndRestoreEtcd(t *testing.T) {
+	testCases := []struct {
+		name          string
+		restore       func(k8sClient kubernetes.Interface, backup *corev1.ConfigMap) func(ctx context.Context, id string) error
+		expectedCalls []string
+		errorMatcher  func(error) bool
+	}{
+		{
+			name: "case 0: restore reverts cluster state",
+			restore: func(k8sClient kubernetes.Interface, backup *corev1.ConfigMap) func(ctx context.Context, id string) error {
+				return func(ctx context.Context, id string) error {
+					err := k8sClient.CoreV1().ConfigMaps(sentinelNamespace).Delete(ctx, postBackupConfigMapName, metav1.DeleteOptions{})
+					if err != nil {
+						return err
+					}
+					_, err = k8sClient.CoreV1().ConfigMaps(sentinelNamespace).Update(ctx, backup, metav1.UpdateOptions{})
+					return err
+				}
+			},
+			expectedCalls: []string{"BackupEtcd()", "RestoreEtcd(backup-1)"},
+			errorMatcher:  nil,
+		},
+		{
+			name: "case 1: restore keeps objects created after backup",
+			restore: func(k8sClient kubernetes.Interface, backup *corev1.ConfigMap) func(ctx context.Context, id string) error {
+				return func(ctx context.Context, id string) error {
+					_, err := k8sClient.CoreV1().ConfigMaps(sentinelNamespace).Update(ctx, backup, metav1.UpdateOptions{})
+					return err
+				}
+			},
+			expectedCalls: []string{"BackupEtcd()", "RestoreEtcd(backup-1)"},
+			errorMatcher:  IsRestoreMismatch,
+		},
+		{
+			name: "case 2: restore keeps sentinel modifications",
+			restore: func(k8sClient kubernetes.Interface, backup *corev1.ConfigMap) func(ctx context.Context, id string) error {
+				return func(ctx context.Context, id string) error {
+					return k8sClient.CoreV1().ConfigMaps(sentinelNamespace).Delete(ctx, postBackupConfigMapName, metav1.DeleteOptions{})
+				}
+			},
+			expectedCalls: []string{"BackupEtcd()", "RestoreEtcd(backup-1)"},
+			errorMatcher:  IsSentinelMismatch,
+		},
+		{
+			name: "case 3: restore fails",
+			restore: func(k8sClient kubernetes.Interface, backup *corev1.ConfigMap) func(ctx context.Context, id string) error {
+				return func(ctx context.Context, id string) error {
+					return errRestoreFailed
+				}
+			},
+			expectedCalls: []string{"BackupEtcd()", "RestoreEtcd(backup-1)"},
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errRestoreFailed
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			backup := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      postBackupSentinelName,
+					Namespace: sentinelNamespace,
+				},
+				Data: map[string]string{
+					"sentinel": "backup",
+				},
+			}
+
+			k8sClient := fake.NewSimpleClientset(backup.DeepCopy())
+
+			p := providertest.New(providertest.Config{
+				RestoreEtcd: tc.restore(k8sClient, backup),
+			})
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        p,
+
+				HealthGate: HealthGateConfig{Disabled: true},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			s, err := c.getSentinel(ctx, sentinel{kind: "configmap", namespace: sentinelNamespace, name: postBackupSentinelName})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			check := func(ctx context.Context) error {
+				return c.verifySentinels(ctx, []sentinel{s})
+			}
+
+			err = c.backupAndRestoreEtcd(ctx, check)
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(p.Calls(), tc.expectedCalls) {
+				t.Fatalf("%s: calls == %v, want %v", tc.name, p.Calls(), tc.expectedCalls)
+			}
+		})
+	}
+}
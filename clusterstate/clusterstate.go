@@ -3,6 +3,7 @@ package clusterstate
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/giantswarm/apprclient/v2"
@@ -12,32 +13,152 @@ import (
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/giantswarm/e2etests/v2/clusterstate/provider"
 )
 
 type Config struct {
-	K8sClient       k8sclient.Interface
+	K8sClient k8sclient.Interface
+	// LegacyFramework is used to wait for the tenant cluster API to go down
+	// and the tenant cluster to be ready. Defaults to a NativeFramework using
+	// K8sClient.
 	LegacyFramework LegacyFramework
 	Logger          micrologger.Logger
 	Provider        provider.Interface
+
+	// DisruptionEvidenceTimeout is the longest period to wait for evidence
+	// that a disruption happened, e.g. a changed node boot ID. Defaults to 5
+	// minutes.
+	DisruptionEvidenceTimeout time.Duration
+	// EtcdBackupRestore appends the etcd backup and restore round trip to the
+	// default scenario. The provider must support restoring etcd backups,
+	// the KVM, AWS and Azure providers return an error matched by
+	// provider.IsNotSupported.
+	EtcdBackupRestore bool
+	// HealthGate configures the component health gate run after every
+	// recovery.
+	HealthGate HealthGateConfig
+	// KeepResources skips all cleanups after the scenario, e.g. the deletion
+	// of the test app, the sentinel objects and the stateful workload, so
+	// that they can be inspected for debugging. Except for the test app
+	// release, which gets upgraded, kept resources have to be deleted before
+	// running the test against the same cluster again.
+	KeepResources bool
+	// MasterDisruption defines how masters of HA clusters are disrupted.
+	// Defaults to MasterDisruptionOneByOne.
+	MasterDisruption MasterDisruptionMode
+	// MaxAPIUnavailability is the longest period the API may be unavailable
+	// while a single master of an HA cluster is disrupted. Defaults to 30
+	// seconds.
+	MaxAPIUnavailability time.Duration
+	// MaxRecoveryTime is the longest period the tenant cluster may take to be
+	// ready again after a disruption started. Defaults to 15 minutes.
+	MaxRecoveryTime time.Duration
+	// NetworkPartition appends a network partition of a master to the default
+	// scenario.
+	NetworkPartition NetworkPartitionConfig
+	// Scenario is the scenario run by Test. Defaults to DefaultScenario.
+	Scenario *Scenario
+	// StatefulWorkload configures the stateful workload installed by the
+	// default scenario.
+	StatefulWorkload StatefulWorkloadConfig
+	// TestApp describes the test app installed and checked by the test.
+	// Empty fields default to the e2e-app-chart from quay.io.
+	TestApp TestAppConfig
+}
+
+// NetworkPartitionConfig configures the network partition isolating a master
+// from all workers. The provider must support network partitions.
+type NetworkPartitionConfig struct {
+	// Enabled appends the network partition to the default scenario.
+	Enabled bool
+	// Duration is the period the partition is held before it expires.
+	// Defaults to 6 minutes, which exceeds the default pod eviction timeout of
+	// 5 minutes, so that pods of unreachable workers get replaced while the
+	// partition is in place.
+	Duration time.Duration
+}
+
+// StatefulWorkloadConfig configures the stateful workload, a stateful set
+// with a persistent volume holding a random dataset which is verified after
+// every disruption.
+type StatefulWorkloadConfig struct {
+	// Disabled removes the stateful workload from the default scenario.
+	Disabled bool
+	// DatasetFiles is the number of 4KiB files of the dataset. Defaults to 16.
+	DatasetFiles int
+	// StorageClass is the storage class used for the persistent volume claim.
+	// Defaults to the default storage class of the tenant cluster.
+	StorageClass string
+}
+
+// HealthGateConfig configures the health gate verifying CoreDNS, all
+// DaemonSets in kube-system, node readiness, stuck pods, cluster DNS and
+// service routing after every recovery.
+type HealthGateConfig struct {
+	// Disabled skips the health gate.
+	Disabled bool
+	// ClusterDomain is the DNS domain of the tenant cluster. Defaults to
+	// "cluster.local".
+	ClusterDomain string
+}
+
+// TestAppConfig describes the chart of the test app and the pods it runs.
+type TestAppConfig struct {
+	// CNRAddress is the address of the CNR registry serving the chart.
+	// Defaults to CNRAddress.
+	CNRAddress string
+	// CNROrganization is the organization of the chart in the CNR registry.
+	// Defaults to CNROrganization.
+	CNROrganization string
+	// ChartChannel is the channel the chart is pulled from. Defaults to
+	// ChartChannel.
+	ChartChannel string
+	// ChartName is the name of the chart, which is also used as release name.
+	// Defaults to ChartName.
+	ChartName string
+	// Namespace is the namespace the chart is installed in. Defaults to
+	// ChartNamespace.
+	Namespace string
+	// Values are the values the chart is installed with.
+	Values map[string]interface{}
+
+	// PodCount is the number of pods the test app runs. Defaults to 2.
+	PodCount int
+	// PodLabelSelector selects the pods of the test app. Defaults to
+	// "app=e2e-app".
+	PodLabelSelector string
 }
 
 type ClusterState struct {
+	chartInstaller  chartInstaller
 	k8sClient       k8sclient.Interface
 	legacyFramework LegacyFramework
 	logger          micrologger.Logger
 	provider        provider.Interface
+
+	disruptionEvidenceTimeout time.Duration
+	healthGate                HealthGateConfig
+	keepResources             bool
+	masterDisruption          MasterDisruptionMode
+	maxAPIUnavailability      time.Duration
+	maxRecoveryTime           time.Duration
+	networkPartition          NetworkPartitionConfig
+	scenario                  Scenario
+	statefulWorkload          StatefulWorkloadConfig
+	testApp                   TestAppConfig
+
+	resultMutex sync.Mutex
+	result      Result
 }
 
 func New(config Config) (*ClusterState, error) {
 	if config.K8sClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
 	}
-	if config.LegacyFramework == nil {
-		return nil, microerror.Maskf(invalidConfigError, "%T.LegacyFramework must not be empty", config)
-	}
 	if config.Logger == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
 	}
@@ -45,143 +166,204 @@ func New(config Config) (*ClusterState, error) {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Provider must not be empty", config)
 	}
 
-	s := &ClusterState{
-		k8sClient:       config.K8sClient,
-		legacyFramework: config.LegacyFramework,
-		logger:          config.Logger,
-		provider:        config.Provider,
+	if config.DisruptionEvidenceTimeout == 0 {
+		config.DisruptionEvidenceTimeout = defaultDisruptionEvidenceTimeout
 	}
+	if config.HealthGate.ClusterDomain == "" {
+		config.HealthGate.ClusterDomain = defaultClusterDomain
+	}
+	if config.MasterDisruption == "" {
+		config.MasterDisruption = MasterDisruptionOneByOne
+	}
+	if config.MasterDisruption != MasterDisruptionOneByOne && config.MasterDisruption != MasterDisruptionAll {
+		return nil, microerror.Maskf(invalidConfigError, "%T.MasterDisruption must be %#q or %#q", config, MasterDisruptionOneByOne, MasterDisruptionAll)
+	}
+	if config.LegacyFramework == nil {
+		c := NativeFrameworkConfig{
+			K8sClient: config.K8sClient,
+			Logger:    config.Logger,
+		}
 
-	return s, nil
-}
-
-func (c *ClusterState) Test(ctx context.Context) error {
-	var err error
-
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "installing e2e-app")
-
-		err = c.InstallTestApp(ctx)
+		f, err := NewNativeFramework(c)
 		if err != nil {
-			return microerror.Mask(err)
+			return nil, microerror.Mask(err)
 		}
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "installed e2e-app")
+		config.LegacyFramework = f
 	}
-
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "checking test app is installed")
-
-		err = c.CheckTestAppIsInstalled(ctx)
-		if err != nil {
-			return microerror.Mask(err)
+	if config.MaxAPIUnavailability == 0 {
+		config.MaxAPIUnavailability = defaultMaxAPIUnavailability
+	}
+	if config.MaxRecoveryTime == 0 {
+		config.MaxRecoveryTime = defaultMaxRecoveryTime
+	}
+	if config.NetworkPartition.Duration == 0 {
+		config.NetworkPartition.Duration = defaultNetworkPartitionDuration
+	}
+	if config.StatefulWorkload.DatasetFiles == 0 {
+		config.StatefulWorkload.DatasetFiles = defaultStatefulWorkloadDatasetFiles
+	}
+	if config.TestApp.CNRAddress == "" {
+		config.TestApp.CNRAddress = CNRAddress
+	}
+	if config.TestApp.CNROrganization == "" {
+		config.TestApp.CNROrganization = CNROrganization
+	}
+	if config.TestApp.ChartChannel == "" {
+		config.TestApp.ChartChannel = ChartChannel
+	}
+	if config.TestApp.ChartName == "" {
+		config.TestApp.ChartName = ChartName
+	}
+	if config.TestApp.Namespace == "" {
+		config.TestApp.Namespace = ChartNamespace
+	}
+	if config.TestApp.PodCount == 0 {
+		config.TestApp.PodCount = defaultTestAppPodCount
+	}
+	if config.TestApp.PodCount < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.TestApp.PodCount must not be negative", config)
+	}
+	if config.TestApp.PodLabelSelector == "" {
+		config.TestApp.PodLabelSelector = defaultTestAppPodLabelSelector
+	}
+	if config.Scenario == nil {
+		scenario := DefaultScenario()
+		if config.StatefulWorkload.Disabled {
+			scenario = scenario.Without(InstallStatefulWorkload().Name)
 		}
-
-		c.logger.LogCtx(ctx, "level", "debug", "message", "test app is installed")
+		if config.NetworkPartition.Enabled {
+			scenario.Steps = append(scenario.Steps, PartitionMaster())
+		}
+		if config.EtcdBackupRestore {
+			scenario.Steps = append(scenario.Steps, BackupAndRestoreEtcd())
+		}
+		config.Scenario = &scenario
 	}
-
 	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "rebooting master")
-
-		err = c.provider.RebootMaster()
+		err := validateScenario(*config.Scenario)
 		if err != nil {
-			return microerror.Mask(err)
+			return nil, microerror.Mask(err)
 		}
-
-		c.logger.LogCtx(ctx, "level", "debug", "message", "rebooted master")
 	}
 
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting api to go down")
-
-		err = c.legacyFramework.WaitForAPIDown()
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	s := &ClusterState{
+		chartInstaller: helmChartInstaller{
+			k8sClient: config.K8sClient,
+			logger:    config.Logger,
+		},
+		k8sClient:       config.K8sClient,
+		legacyFramework: config.LegacyFramework,
+		logger:          config.Logger,
+		provider:        config.Provider,
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "api is down")
+		disruptionEvidenceTimeout: config.DisruptionEvidenceTimeout,
+		healthGate:                config.HealthGate,
+		keepResources:             config.KeepResources,
+		masterDisruption:          config.MasterDisruption,
+		maxAPIUnavailability:      config.MaxAPIUnavailability,
+		maxRecoveryTime:           config.MaxRecoveryTime,
+		networkPartition:          config.NetworkPartition,
+		scenario:                  *config.Scenario,
+		statefulWorkload:          config.StatefulWorkload,
+		testApp:                   config.TestApp,
 	}
 
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for guest cluster")
-
-		err = c.legacyFramework.WaitForGuestReady(ctx)
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	return s, nil
+}
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "guest cluster ready")
+// Test runs the configured scenario, which is DefaultScenario unless
+// configured otherwise.
+func (c *ClusterState) Test(ctx context.Context) error {
+	err := c.Run(ctx, c.scenario)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "checking test app is installed")
-
-		err = c.CheckTestAppIsInstalled(ctx)
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	return nil
+}
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "test app is installed")
-	}
+// InstallTestApp installs the test app chart. An existing release of the test
+// app, e.g. left behind by an earlier run, is upgraded instead. The test app
+// namespace is created unless it exists and labeled as managed by e2etests,
+// so that DeleteTestApp only deletes it if the test created it.
+func (c *ClusterState) InstallTestApp(ctx context.Context) error {
+	c.logger.Log("level", "debug", "message", fmt.Sprintf("installing %#q for testing", c.testApp.ChartName))
 
 	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "replacing master node")
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: c.testApp.Namespace,
+				Labels: map[string]string{
+					managedByLabel: managedByValue,
+				},
+			},
+		}
 
-		err = c.provider.ReplaceMaster()
-		if err != nil {
+		_, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			c.logger.Log("level", "debug", "message", fmt.Sprintf("namespace %#q already exists", c.testApp.Namespace))
+		} else if err != nil {
 			return microerror.Mask(err)
 		}
+	}
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "master node replaced")
+	err := c.chartInstaller.Install(ctx, c.testApp)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting api to go down")
+	return nil
+}
 
-		err = c.legacyFramework.WaitForAPIDown()
-		if err != nil {
-			return microerror.Mask(err)
-		}
+// DeleteTestApp deletes the test app release. Its namespace is only deleted
+// if InstallTestApp created it, so that shared namespaces are kept. It
+// succeeds if the test app is not installed.
+func (c *ClusterState) DeleteTestApp(ctx context.Context) error {
+	c.logger.Log("level", "debug", "message", fmt.Sprintf("deleting %#q", c.testApp.ChartName))
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "api is down")
+	err := c.chartInstaller.Delete(ctx, c.testApp)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for guest cluster")
-
-		err = c.legacyFramework.WaitForGuestReady(ctx)
-		if err != nil {
-			return microerror.Mask(err)
-		}
-
-		c.logger.LogCtx(ctx, "level", "debug", "message", "guest cluster ready")
+	err = c.deleteManagedNamespace(ctx, c.testApp.Namespace)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
-	{
-		c.logger.LogCtx(ctx, "level", "debug", "message", "checking test app is installed")
+	c.logger.Log("level", "debug", "message", fmt.Sprintf("deleted %#q", c.testApp.ChartName))
 
-		err = c.CheckTestAppIsInstalled(ctx)
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	return nil
+}
 
-		c.logger.LogCtx(ctx, "level", "debug", "message", "test app is installed")
-	}
+// chartInstaller installs and deletes the chart of the test app. It is
+// replaced in tests, so that scenarios run without a chart registry and Helm.
+type chartInstaller interface {
+	// Install installs the chart or upgrades an existing release.
+	Install(ctx context.Context, testApp TestAppConfig) error
+	// Delete deletes the release. It succeeds if the release does not exist.
+	Delete(ctx context.Context, testApp TestAppConfig) error
+}
 
-	return nil
+// helmChartInstaller pulls the test app chart from its CNR registry and
+// installs it using Helm.
+type helmChartInstaller struct {
+	k8sClient k8sclient.Interface
+	logger    micrologger.Logger
 }
 
-func (c *ClusterState) InstallTestApp(ctx context.Context) error {
+func (h helmChartInstaller) Install(ctx context.Context, testApp TestAppConfig) error {
 	var err error
 
 	var apprClient *apprclient.Client
 	{
 		c := apprclient.Config{
 			Fs:     afero.NewOsFs(),
-			Logger: c.logger,
+			Logger: h.logger,
 
-			Address:      CNRAddress,
-			Organization: CNROrganization,
+			Address:      testApp.CNRAddress,
+			Organization: testApp.CNROrganization,
 		}
 
 		apprClient, err = apprclient.New(c)
@@ -190,33 +372,35 @@ func (c *ClusterState) InstallTestApp(ctx context.Context) error {
 		}
 	}
 
-	var helmClient *helmclient.Client
-	{
-		c := helmclient.Config{
-			Logger:    c.logger,
-			K8sClient: c.k8sClient,
-		}
-
-		helmClient, err = helmclient.New(c)
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	helmClient, err := h.newHelmClient()
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
-	// Install the e2e app chart in the guest cluster.
-	{
-		c.logger.Log("level", "debug", "message", "installing e2e-app for testing")
+	tarballPath, err := apprClient.PullChartTarball(ctx, testApp.ChartName, testApp.ChartChannel)
+	if err != nil {
+		return microerror.Mask(err)
+	}
 
-		tarballPath, err := apprClient.PullChartTarball(ctx, ChartName, ChartChannel)
+	_, err = helmClient.GetReleaseContent(ctx, testApp.Namespace, testApp.ChartName)
+	if helmclient.IsReleaseNotFound(err) {
+		opts := helmclient.InstallOptions{
+			ReleaseName: testApp.ChartName,
+			Wait:        true,
+		}
+		err = helmClient.InstallReleaseFromTarball(ctx, tarballPath, testApp.Namespace, testApp.Values, opts)
 		if err != nil {
 			return microerror.Mask(err)
 		}
+	} else if err != nil {
+		return microerror.Mask(err)
+	} else {
+		h.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("release %#q already exists, upgrading it", testApp.ChartName))
 
-		opts := helmclient.InstallOptions{
-			ReleaseName: ChartName,
-			Wait:        true,
+		opts := helmclient.UpdateOptions{
+			Wait: true,
 		}
-		err = helmClient.InstallReleaseFromTarball(ctx, tarballPath, ChartNamespace, nil, opts)
+		err = helmClient.UpdateReleaseFromTarball(ctx, tarballPath, testApp.Namespace, testApp.ChartName, testApp.Values, opts)
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -225,16 +409,46 @@ func (c *ClusterState) InstallTestApp(ctx context.Context) error {
 	return nil
 }
 
+func (h helmChartInstaller) Delete(ctx context.Context, testApp TestAppConfig) error {
+	helmClient, err := h.newHelmClient()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = helmClient.DeleteRelease(ctx, testApp.Namespace, testApp.ChartName)
+	if helmclient.IsReleaseNotFound(err) {
+		h.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("release %#q does not exist", testApp.ChartName))
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (h helmChartInstaller) newHelmClient() (*helmclient.Client, error) {
+	c := helmclient.Config{
+		Logger:    h.logger,
+		K8sClient: h.k8sClient,
+	}
+
+	helmClient, err := helmclient.New(c)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return helmClient, nil
+}
+
 func (c *ClusterState) CheckTestAppIsInstalled(ctx context.Context) error {
-	var podCount = 2
+	var podCount = c.testApp.PodCount
 
-	c.logger.Log("level", "debug", "message", fmt.Sprintf("waiting for %d pods of the e2e-app to be up", podCount))
+	c.logger.Log("level", "debug", "message", fmt.Sprintf("waiting for %d pods of %#q to be up", podCount, c.testApp.ChartName))
 
 	o := func() error {
 		lo := metav1.ListOptions{
-			LabelSelector: "app=e2e-app",
+			LabelSelector: c.testApp.PodLabelSelector,
 		}
-		l, err := c.k8sClient.K8sClient().CoreV1().Pods(ChartNamespace).List(ctx, lo)
+		l, err := c.k8sClient.K8sClient().CoreV1().Pods(c.testApp.Namespace).List(ctx, lo)
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -255,7 +469,7 @@ func (c *ClusterState) CheckTestAppIsInstalled(ctx context.Context) error {
 		return microerror.Mask(err)
 	}
 
-	c.logger.Log("level", "debug", "message", fmt.Sprintf("found %d pods of the e2e-app", podCount))
+	c.logger.Log("level", "debug", "message", fmt.Sprintf("found %d pods of %#q", podCount, c.testApp.ChartName))
 
 	return nil
 }
@@ -0,0 +1,449 @@
+package clusterstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+func Test_ClusterState_TestApp(t *testing.T) {
+	pod := func(name, namespace, app string) runtime.Object {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": app,
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name            string
+		testApp         TestAppConfig
+		objects         []runtime.Object
+		expectedTestApp TestAppConfig
+		errorMatcher    func(error) bool
+	}{
+		{
+			name:    "case 0: defaults",
+			testApp: TestAppConfig{},
+			objects: []runtime.Object{
+				pod("e2e-app-1", ChartNamespace, "e2e-app"),
+				pod("e2e-app-2", ChartNamespace, "e2e-app"),
+			},
+			expectedTestApp: TestAppConfig{
+				CNRAddress:       CNRAddress,
+				CNROrganization:  CNROrganization,
+				ChartChannel:     ChartChannel,
+				ChartName:        ChartName,
+				Namespace:        ChartNamespace,
+				PodCount:         2,
+				PodLabelSelector: "app=e2e-app",
+			},
+			errorMatcher: nil,
+		},
+		{
+			name: "case 1: custom test app from mirror",
+			testApp: TestAppConfig{
+				CNRAddress:       "https://mirror.example.com",
+				ChartName:        "shop-app-chart",
+				Namespace:        "shop",
+				Values:           map[string]interface{}{"replicas": 3},
+				PodCount:         3,
+				PodLabelSelector: "app=shop",
+			},
+			objects: []runtime.Object{
+				pod("shop-1", "shop", "shop"),
+				pod("shop-2", "shop", "shop"),
+				pod("shop-3", "shop", "shop"),
+				pod("e2e-app-1", ChartNamespace, "e2e-app"),
+			},
+			expectedTestApp: TestAppConfig{
+				CNRAddress:       "https://mirror.example.com",
+				CNROrganization:  CNROrganization,
+				ChartChannel:     ChartChannel,
+				ChartName:        "shop-app-chart",
+				Namespace:        "shop",
+				Values:           map[string]interface{}{"replicas": 3},
+				PodCount:         3,
+				PodLabelSelector: "app=shop",
+			},
+			errorMatcher: nil,
+		},
+		{
+			name: "case 2: negative pod count",
+			testApp: TestAppConfig{
+				PodCount: -1,
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			c, err := New(Config{
+				K8sClient: k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: fake.NewSimpleClientset(tc.objects...)}),
+				Logger:    microloggertest.New(),
+				Provider:  providertest.New(providertest.Config{}),
+
+				TestApp: tc.testApp,
+			})
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(c.testApp, tc.expectedTestApp) {
+				t.Fatalf("%s: test app == %#v, want %#v", tc.name, c.testApp, tc.expectedTestApp)
+			}
+
+			err = c.CheckTestAppIsInstalled(context.Background())
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+		})
+	}
+}
+
+var (
+	errChartInstallFailed = errors.New("chart install failed")
+	errGuestNotReady      = errors.New("guest not ready")
+	errRebootFailed       = errors.New("reboot failed")
+)
+
+type chartInstallerFake struct {
+	calls []string
+	err   error
+}
+
+func (f *chartInstallerFake) Install(ctx context.Context, testApp TestAppConfig) error {
+	f.calls = append(f.calls, fmt.Sprintf("Install(%s)", testApp.ChartName))
+	return f.err
+}
+
+func (f *chartInstallerFake) Delete(ctx context.Context, testApp TestAppConfig) error {
+	f.calls = append(f.calls, fmt.Sprintf("Delete(%s)", testApp.ChartName))
+	return nil
+}
+
+func Test_ClusterState_Test(t *testing.T) {
+	testCases := []struct {
+		name string
+		// disrupt wraps the disruptions of the fake cluster.
+		disrupt         func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error
+		framework       clusterstatetest.FrameworkConfig
+		installErr      error
+		masters         []string
+		maxRecoveryTime time.Duration
+		expectedCalls   []string
+		// expectedHealthChecks is the number of health gate runs.
+		expectedHealthChecks int
+		errorMatcher         func(error) bool
+	}{
+		{
+			name: "case 0: default scenario with single master",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return cluster.Disrupt
+			},
+			masters: []string{"m1"},
+			expectedCalls: []string{
+				"Masters()",
+				"RebootMaster(m1)",
+				"Masters()",
+				"ReplaceMaster(m1)",
+				"Workers()",
+				"RebootWorker(w1)",
+				"Workers()",
+				"DrainWorker(w1)",
+				"Workers()",
+				"ReplaceWorker(w1)",
+			},
+			expectedHealthChecks: 5,
+			errorMatcher:         nil,
+		},
+		{
+			name: "case 1: default scenario with HA masters",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return cluster.Disrupt
+			},
+			masters: []string{"m1", "m2", "m3"},
+			expectedCalls: []string{
+				"Masters()",
+				"RebootMaster(m1)",
+				"RebootMaster(m2)",
+				"RebootMaster(m3)",
+				"Masters()",
+				"ReplaceMaster(m1)",
+				"ReplaceMaster(m2)",
+				"ReplaceMaster(m3)",
+				"Workers()",
+				"RebootWorker(w1)",
+				"Workers()",
+				"DrainWorker(w1)",
+				"Workers()",
+				"ReplaceWorker(w1)",
+			},
+			expectedHealthChecks: 9,
+			errorMatcher:         nil,
+		},
+		{
+			name: "case 2: chart install fails",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return cluster.Disrupt
+			},
+			installErr:           errChartInstallFailed,
+			masters:              []string{"m1"},
+			expectedCalls:        nil,
+			expectedHealthChecks: 0,
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errChartInstallFailed
+			},
+		},
+		{
+			name: "case 3: reboot fails",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return func(ctx context.Context, method, id string) error {
+					return errRebootFailed
+				}
+			},
+			masters:              []string{"m1"},
+			expectedCalls:        []string{"Masters()", "RebootMaster(m1)"},
+			expectedHealthChecks: 0,
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errRebootFailed
+			},
+		},
+		{
+			name: "case 4: reboot leaves no evidence",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return nil
+			},
+			masters:              []string{"m1"},
+			expectedCalls:        []string{"Masters()", "RebootMaster(m1)"},
+			expectedHealthChecks: 0,
+			errorMatcher:         IsNoDisruptionEvidence,
+		},
+		{
+			name: "case 5: guest cluster never gets ready",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return cluster.Disrupt
+			},
+			framework: clusterstatetest.FrameworkConfig{
+				WaitForGuestReady: func(ctx context.Context) error {
+					return errGuestNotReady
+				},
+			},
+			masters:              []string{"m1"},
+			expectedCalls:        []string{"Masters()", "RebootMaster(m1)"},
+			expectedHealthChecks: 0,
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errGuestNotReady
+			},
+		},
+		{
+			name: "case 6: slow recovery exceeds recovery budget",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return cluster.Disrupt
+			},
+			framework: clusterstatetest.FrameworkConfig{
+				RecoveryDelay: 50 * time.Millisecond,
+			},
+			masters:              []string{"m1"},
+			maxRecoveryTime:      10 * time.Millisecond,
+			expectedCalls:        []string{"Masters()", "RebootMaster(m1)"},
+			expectedHealthChecks: 0,
+			errorMatcher:         IsRecoveryBudgetExceeded,
+		},
+		{
+			name: "case 7: replaced master keeps its node",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return func(ctx context.Context, method, id string) error {
+					if method == "ReplaceMaster" {
+						method = "RebootMaster"
+					}
+					return cluster.Disrupt(ctx, method, id)
+				}
+			},
+			masters:              []string{"m1"},
+			expectedCalls:        []string{"Masters()", "RebootMaster(m1)", "Masters()", "ReplaceMaster(m1)"},
+			expectedHealthChecks: 2,
+			errorMatcher:         IsMasterNotReplaced,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := clusterstatetest.NewCluster(clusterstatetest.ClusterConfig{
+				Masters: tc.masters,
+				Workers: []string{"w1", "w2"},
+			})
+
+			p := providertest.New(providertest.Config{
+				Masters:  tc.masters,
+				Workers:  []string{"w1", "w2"},
+				Disrupt:  tc.disrupt(cluster),
+				NodeName: cluster.NodeName,
+			})
+
+			c, err := New(Config{
+				K8sClient:       cluster.Clients(),
+				LegacyFramework: clusterstatetest.NewFramework(tc.framework),
+				Logger:          microloggertest.New(),
+				Provider:        p,
+
+				DisruptionEvidenceTimeout: 10 * time.Millisecond,
+				MaxRecoveryTime:           tc.maxRecoveryTime,
+				StatefulWorkload:          StatefulWorkloadConfig{Disabled: true},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			c.chartInstaller = &chartInstallerFake{err: tc.installErr}
+
+			err = c.Test(context.Background())
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(p.Calls(), tc.expectedCalls) {
+				t.Fatalf("%s: calls == %#v, want %#v", tc.name, p.Calls(), tc.expectedCalls)
+			}
+
+			healthChecks := c.Result().HealthChecks
+			if len(healthChecks) != tc.expectedHealthChecks {
+				t.Fatalf("%s: health checks == %d, want %d", tc.name, len(healthChecks), tc.expectedHealthChecks)
+			}
+		})
+	}
+}
+
+func Test_ClusterState_cleanup(t *testing.T) {
+	managedByE2ETests := map[string]string{managedByLabel: managedByValue}
+
+	testCases := []struct {
+		name          string
+		keepResources bool
+		// testAppNamespaceLabels are the labels of the existing test app
+		// namespace.
+		testAppNamespaceLabels          map[string]string
+		expectedInstallerCalls          []string
+		expectedTestAppNamespaceExists  bool
+		expectedSentinelNamespaceExists bool
+	}{
+		{
+			name:                            "case 0: resources are deleted after the scenario",
+			keepResources:                   false,
+			testAppNamespaceLabels:          managedByE2ETests,
+			expectedInstallerCalls:          []string{"Install(e2e-app-chart)", "Delete(e2e-app-chart)"},
+			expectedTestAppNamespaceExists:  false,
+			expectedSentinelNamespaceExists: false,
+		},
+		{
+			name:                            "case 1: resources are kept",
+			keepResources:                   true,
+			testAppNamespaceLabels:          managedByE2ETests,
+			expectedInstallerCalls:          []string{"Install(e2e-app-chart)"},
+			expectedTestAppNamespaceExists:  true,
+			expectedSentinelNamespaceExists: true,
+		},
+		{
+			name:                            "case 2: shared test app namespace not created by the test is kept",
+			keepResources:                   false,
+			testAppNamespaceLabels:          nil,
+			expectedInstallerCalls:          []string{"Install(e2e-app-chart)", "Delete(e2e-app-chart)"},
+			expectedTestAppNamespaceExists:  true,
+			expectedSentinelNamespaceExists: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			cluster := clusterstatetest.NewCluster(clusterstatetest.ClusterConfig{
+				Masters: []string{"m1"},
+				Workers: []string{"w1"},
+
+				TestAppNamespaceLabels: tc.testAppNamespaceLabels,
+			})
+
+			c, err := New(Config{
+				K8sClient:       cluster.Clients(),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{}),
+
+				KeepResources: tc.keepResources,
+				Scenario: &Scenario{
+					Name: "install",
+					Steps: []Step{
+						InstallTestApp(),
+						CheckTestApp(),
+						WriteSentinels(),
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			installer := &chartInstallerFake{}
+			c.chartInstaller = installer
+
+			err = c.Test(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			if !reflect.DeepEqual(installer.calls, tc.expectedInstallerCalls) {
+				t.Fatalf("%s: installer calls == %#v, want %#v", tc.name, installer.calls, tc.expectedInstallerCalls)
+			}
+
+			expectedNamespacesExist := map[string]bool{
+				ChartNamespace:    tc.expectedTestAppNamespaceExists,
+				sentinelNamespace: tc.expectedSentinelNamespaceExists,
+			}
+			for namespace, exists := range expectedNamespacesExist {
+				_, err := cluster.K8sClient().CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+				if exists && err != nil {
+					t.Fatalf("%s: namespace %#q error == %#v, want nil", tc.name, namespace, err)
+				}
+				if !exists && !apierrors.IsNotFound(err) {
+					t.Fatalf("%s: namespace %#q error == %#v, want not found", tc.name, namespace, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+package clusterstatetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/microerror"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	defaultTestAppNamespace = "e2e-app"
+	defaultTestAppPods      = 2
+
+	masterRoleLabel = "node-role.kubernetes.io/master"
+	workerRoleLabel = "node-role.kubernetes.io/worker"
+)
+
+type ClusterConfig struct {
+	// Masters are the IDs of the masters. Every master is registered as node
+	// master-<id>.
+	Masters []string
+	// Workers are the IDs of the workers. Every worker is registered as node
+	// worker-<id>.
+	Workers []string
+
+	// TestAppNamespace is the namespace of the test app pods. Defaults to
+	// "e2e-app".
+	TestAppNamespace string
+	// TestAppNamespaceLabels are the labels of the test app namespace.
+	TestAppNamespaceLabels map[string]string
+	// TestAppPodLabels are the labels of the test app pods. Defaults to
+	// app=e2e-app.
+	TestAppPodLabels map[string]string
+	// TestAppPods is the number of ready test app pods spread across the
+	// workers. Defaults to 2.
+	TestAppPods int
+}
+
+// Cluster is an in-memory tenant cluster backed by fake clientsets. It is
+// seeded with ready master and worker nodes, the test app namespace with ready
+// test app pods, CoreDNS and kube-proxy. Disrupt simulates provider
+// disruptions on its nodes, so that clusterstate scenarios run offline in
+// combination with providertest.Provider. Partitioning a master turns all
+// workers not ready until the partition is healed. Pods which run to
+// completion succeed immediately, services with a selector get a ready
+// endpoint immediately and custom resource definitions are established
+// immediately. Pods cannot be proxied, so the stateful workload is not
+// supported.
+type Cluster struct {
+	clients   *k8sclienttest.Clients
+	dynClient *dynamicfake.FakeDynamicClient
+	extClient *apiextensionsfake.Clientset
+	k8sClient *fake.Clientset
+
+	mutex      sync.Mutex
+	generation int
+	// nodes maps master and worker IDs to their current node names.
+	nodes map[string]string
+}
+
+func NewCluster(config ClusterConfig) *Cluster {
+	if config.TestAppNamespace == "" {
+		config.TestAppNamespace = defaultTestAppNamespace
+	}
+	if config.TestAppPodLabels == nil {
+		config.TestAppPodLabels = map[string]string{"app": "e2e-app"}
+	}
+	if config.TestAppPods == 0 {
+		config.TestAppPods = defaultTestAppPods
+	}
+
+	c := &Cluster{
+		nodes: map[string]string{},
+	}
+
+	var objects []runtime.Object
+	for _, id := range config.Masters {
+		n := newNode(fmt.Sprintf("master-%s", id), masterRoleLabel)
+		c.nodes[id] = n.Name
+		objects = append(objects, n)
+	}
+	for _, id := range config.Workers {
+		n := newNode(fmt.Sprintf("worker-%s", id), workerRoleLabel)
+		c.nodes[id] = n.Name
+		objects = append(objects, n)
+	}
+	for i := 0; i < config.TestAppPods; i++ {
+		var nodeName string
+		if len(config.Workers) > 0 {
+			nodeName = c.nodes[config.Workers[i%len(config.Workers)]]
+		}
+
+		objects = append(objects, newPod(fmt.Sprintf("e2e-app-%d", i), config.TestAppNamespace, config.TestAppPodLabels, nodeName))
+	}
+	objects = append(objects, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   config.TestAppNamespace,
+			Labels: config.TestAppNamespaceLabels,
+		},
+	})
+	objects = append(objects, newKubeSystemObjects(len(config.Masters)+len(config.Workers))...)
+
+	c.k8sClient = fake.NewSimpleClientset(objects...)
+	c.k8sClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		p := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		if p.Spec.RestartPolicy == corev1.RestartPolicyNever {
+			p.Status.Phase = corev1.PodSucceeded
+		}
+		return false, nil, nil
+	})
+	c.k8sClient.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		svc := action.(k8stesting.CreateAction).GetObject().(*corev1.Service)
+		if len(svc.Spec.Selector) == 0 {
+			return false, nil, nil
+		}
+
+		err := c.k8sClient.Tracker().Add(newEndpoints(svc))
+		if apierrors.IsAlreadyExists(err) {
+			// Fall through to let creating the service fail.
+		} else if err != nil {
+			return true, nil, microerror.Mask(err)
+		}
+
+		return false, nil, nil
+	})
+
+	c.extClient = apiextensionsfake.NewSimpleClientset()
+	c.extClient.PrependReactor("create", "customresourcedefinitions", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		crd := action.(k8stesting.CreateAction).GetObject().(*apiextensionsv1.CustomResourceDefinition)
+		crd.Status.Conditions = append(crd.Status.Conditions, apiextensionsv1.CustomResourceDefinitionCondition{
+			Type:   apiextensionsv1.Established,
+			Status: apiextensionsv1.ConditionTrue,
+		})
+		return false, nil, nil
+	})
+
+	c.dynClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	c.clients = k8sclienttest.NewClients(k8sclienttest.ClientsConfig{
+		DynClient: c.dynClient,
+		ExtClient: c.extClient,
+		K8sClient: c.k8sClient,
+	})
+
+	return c
+}
+
+// Clients returns the clients of the cluster.
+func (c *Cluster) Clients() k8sclient.Interface {
+	return c.clients
+}
+
+// K8sClient returns the fake Kubernetes clientset of the cluster, e.g. to add
+// reactors or objects.
+func (c *Cluster) K8sClient() *fake.Clientset {
+	return c.k8sClient
+}
+
+// NodeName returns the name of the current node of the master or worker with
+// the given ID, which changes when the node is replaced. It can be used as
+// providertest.Config.NodeName.
+func (c *Cluster) NodeName(ctx context.Context, id string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	name, ok := c.nodes[id]
+	if !ok {
+		return "", microerror.Maskf(notFoundError, "node of %#q", id)
+	}
+
+	return name, nil
+}
+
+// Disrupt applies the disruption of the given provider method to the node of
+// the master or worker with the given ID. It can be used as
+// providertest.Config.Disrupt.
+//
+//   - Rebooting gives the node a new boot ID.
+//   - Replacing registers a new node with a new name and UID and reschedules
+//     its pods.
+//   - Draining cordons the node and reschedules its pods.
+func (c *Cluster) Disrupt(ctx context.Context, method, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if method == "HealPartition" {
+		err := c.setWorkersReady(ctx, corev1.ConditionTrue)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+
+	name, ok := c.nodes[id]
+	if !ok {
+		return microerror.Maskf(notFoundError, "node of %#q", id)
+	}
+
+	node, err := c.k8sClient.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	switch method {
+	case "RebootMaster", "RebootWorker":
+		node.Status.NodeInfo.BootID = rand.String(8)
+		node.Status.Conditions = readyConditions()
+
+		_, err = c.k8sClient.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+	case "ReplaceMaster", "ReplaceWorker":
+		c.generation++
+
+		role := workerRoleLabel
+		if _, ok := node.Labels[masterRoleLabel]; ok {
+			role = masterRoleLabel
+		}
+		replacement := newNode(fmt.Sprintf("%s-%d", name, c.generation), role)
+
+		err = c.k8sClient.CoreV1().Nodes().Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		_, err = c.k8sClient.CoreV1().Nodes().Create(ctx, replacement, metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		c.nodes[id] = replacement.Name
+
+		err = c.reschedulePods(ctx, name)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+	case "DrainWorker":
+		node.Spec.Unschedulable = true
+
+		_, err = c.k8sClient.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = c.reschedulePods(ctx, name)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+	case "PartitionMaster":
+		err = c.setWorkersReady(ctx, corev1.ConditionUnknown)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+	default:
+		return microerror.Maskf(notFoundError, "disruption of method %#q", method)
+	}
+
+	return nil
+}
+
+// setWorkersReady sets the ready condition of all worker nodes to the given
+// status.
+func (c *Cluster) setWorkersReady(ctx context.Context, status corev1.ConditionStatus) error {
+	l, err := c.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: workerRoleLabel})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for _, n := range l.Items {
+		n.Status.Conditions = readyConditions()
+		n.Status.Conditions[0].Status = status
+
+		_, err = c.k8sClient.CoreV1().Nodes().Update(ctx, &n, metav1.UpdateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// reschedulePods recreates all pods running on the node with the given name on
+// the first other schedulable worker node. Pods stay pending if there is no
+// such node.
+func (c *Cluster) reschedulePods(ctx context.Context, nodeName string) error {
+	var target string
+	{
+		l, err := c.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: workerRoleLabel})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		for _, n := range l.Items {
+			if n.Name != nodeName && !n.Spec.Unschedulable {
+				target = n.Name
+				break
+			}
+		}
+	}
+
+	l, err := c.k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for _, p := range l.Items {
+		if p.Spec.NodeName != nodeName {
+			continue
+		}
+
+		err = c.k8sClient.CoreV1().Pods(p.Namespace).Delete(ctx, p.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		_, err = c.k8sClient.CoreV1().Pods(p.Namespace).Create(ctx, newPod(fmt.Sprintf("%s-%s", p.Name, rand.String(5)), p.Namespace, p.Labels, target), metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+func newKubeSystemObjects(nodes int) []runtime.Object {
+	replicas := int32(2)
+
+	coreDNS := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "coredns",
+			Namespace: metav1.NamespaceSystem,
+			Labels: map[string]string{
+				"k8s-app": "coredns",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: appsv1.DeploymentStatus{
+			AvailableReplicas: replicas,
+			ReadyReplicas:     replicas,
+		},
+	}
+
+	kubeProxy := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-proxy",
+			Namespace: metav1.NamespaceSystem,
+		},
+		Status: appsv1.DaemonSetStatus{
+			DesiredNumberScheduled: int32(nodes),
+			UpdatedNumberScheduled: int32(nodes),
+			NumberAvailable:        int32(nodes),
+		},
+	}
+
+	return []runtime.Object{coreDNS, kubeProxy}
+}
+
+func newNode(name, role string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(rand.String(16)),
+			Labels: map[string]string{
+				role: "",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: readyConditions(),
+			NodeInfo: corev1.NodeSystemInfo{
+				BootID: rand.String(8),
+			},
+		},
+	}
+}
+
+// newPod returns a pod which is ready on the node with the given name or
+// pending if the name is empty.
+func newPod(name, namespace string, labels map[string]string, nodeName string) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+		},
+	}
+
+	if nodeName != "" {
+		p.Status.Phase = corev1.PodRunning
+		p.Status.Conditions = []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+		}
+	}
+
+	return p
+}
+
+// newEndpoints returns endpoints with a single ready address for the given
+// service, like the endpoints controller creates them for ready pods.
+func newEndpoints(svc *corev1.Service) *corev1.Endpoints {
+	e := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{IP: "10.0.0.1"},
+				},
+			},
+		},
+	}
+
+	for _, p := range svc.Spec.Ports {
+		e.Subsets[0].Ports = append(e.Subsets[0].Ports, corev1.EndpointPort{Port: p.TargetPort.IntVal})
+	}
+
+	return e
+}
+
+func readyConditions() []corev1.NodeCondition {
+	return []corev1.NodeCondition{
+		{
+			Type:               corev1.NodeReady,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(time.Now()),
+		},
+	}
+}
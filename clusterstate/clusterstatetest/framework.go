@@ -0,0 +1,87 @@
+package clusterstatetest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type FrameworkConfig struct {
+	// WaitForAPIDown is called by WaitForAPIDown if set, e.g. to simulate an
+	// API which never goes down.
+	WaitForAPIDown func() error
+	// WaitForGuestReady is called by WaitForGuestReady if set, e.g. to
+	// simulate a tenant cluster which never recovers.
+	WaitForGuestReady func(ctx context.Context) error
+
+	// RecoveryDelay delays every WaitForGuestReady call, simulating a slowly
+	// recovering tenant cluster.
+	RecoveryDelay time.Duration
+}
+
+// Framework is a fake clusterstate.LegacyFramework implementation which
+// records all calls and returns scripted outcomes.
+type Framework struct {
+	waitForAPIDown    func() error
+	waitForGuestReady func(ctx context.Context) error
+
+	recoveryDelay time.Duration
+
+	mutex sync.Mutex
+	calls []string
+}
+
+func NewFramework(config FrameworkConfig) *Framework {
+	f := &Framework{
+		waitForAPIDown:    config.WaitForAPIDown,
+		waitForGuestReady: config.WaitForGuestReady,
+
+		recoveryDelay: config.RecoveryDelay,
+	}
+
+	return f
+}
+
+// Calls returns all calls made to the framework in order, e.g.
+// "WaitForGuestReady()".
+func (f *Framework) Calls() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]string(nil), f.calls...)
+}
+
+func (f *Framework) WaitForAPIDown() error {
+	f.record("WaitForAPIDown()")
+
+	if f.waitForAPIDown != nil {
+		return f.waitForAPIDown()
+	}
+
+	return nil
+}
+
+func (f *Framework) WaitForGuestReady(ctx context.Context) error {
+	f.record("WaitForGuestReady()")
+
+	if f.recoveryDelay != 0 {
+		select {
+		case <-time.After(f.recoveryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if f.waitForGuestReady != nil {
+		return f.waitForGuestReady(ctx)
+	}
+
+	return nil
+}
+
+func (f *Framework) record(call string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls = append(f.calls, call)
+}
@@ -28,3 +28,111 @@ var waitError = &microerror.Error{
 func IsWait(err error) bool {
 	return microerror.Cause(err) == waitError
 }
+
+var masterNotReplacedError = &microerror.Error{
+	Kind: "masterNotReplacedError",
+}
+
+// IsMasterNotReplaced asserts masterNotReplacedError.
+func IsMasterNotReplaced(err error) bool {
+	return microerror.Cause(err) == masterNotReplacedError
+}
+
+var apiUnavailableError = &microerror.Error{
+	Kind: "apiUnavailableError",
+}
+
+// IsAPIUnavailable asserts apiUnavailableError.
+func IsAPIUnavailable(err error) bool {
+	return microerror.Cause(err) == apiUnavailableError
+}
+
+var sentinelMismatchError = &microerror.Error{
+	Kind: "sentinelMismatchError",
+}
+
+// IsSentinelMismatch asserts sentinelMismatchError.
+func IsSentinelMismatch(err error) bool {
+	return microerror.Cause(err) == sentinelMismatchError
+}
+
+var statefulWorkloadError = &microerror.Error{
+	Kind: "statefulWorkloadError",
+}
+
+// IsStatefulWorkload asserts statefulWorkloadError.
+func IsStatefulWorkload(err error) bool {
+	return microerror.Cause(err) == statefulWorkloadError
+}
+
+var workerCountMismatchError = &microerror.Error{
+	Kind: "workerCountMismatchError",
+}
+
+// IsWorkerCountMismatch asserts workerCountMismatchError.
+func IsWorkerCountMismatch(err error) bool {
+	return microerror.Cause(err) == workerCountMismatchError
+}
+
+var restoreMismatchError = &microerror.Error{
+	Kind: "restoreMismatchError",
+}
+
+// IsRestoreMismatch asserts restoreMismatchError.
+func IsRestoreMismatch(err error) bool {
+	return microerror.Cause(err) == restoreMismatchError
+}
+
+var recoveryBudgetExceededError = &microerror.Error{
+	Kind: "recoveryBudgetExceededError",
+}
+
+// IsRecoveryBudgetExceeded asserts recoveryBudgetExceededError.
+func IsRecoveryBudgetExceeded(err error) bool {
+	return microerror.Cause(err) == recoveryBudgetExceededError
+}
+
+var noDisruptionEvidenceError = &microerror.Error{
+	Kind: "noDisruptionEvidenceError",
+}
+
+// IsNoDisruptionEvidence asserts noDisruptionEvidenceError.
+func IsNoDisruptionEvidence(err error) bool {
+	return microerror.Cause(err) == noDisruptionEvidenceError
+}
+
+var datasetMismatchError = &microerror.Error{
+	Kind: "datasetMismatchError",
+}
+
+// IsDatasetMismatch asserts datasetMismatchError.
+func IsDatasetMismatch(err error) bool {
+	return microerror.Cause(err) == datasetMismatchError
+}
+
+var unhealthyComponentsError = &microerror.Error{
+	Kind: "unhealthyComponentsError",
+}
+
+// IsUnhealthyComponents asserts unhealthyComponentsError.
+func IsUnhealthyComponents(err error) bool {
+	return microerror.Cause(err) == unhealthyComponentsError
+}
+
+var podCountMismatchError = &microerror.Error{
+	Kind: "podCountMismatchError",
+}
+
+// IsPodCountMismatch asserts podCountMismatchError.
+func IsPodCountMismatch(err error) bool {
+	return microerror.Cause(err) == podCountMismatchError
+}
+
+var namespaceNotDeletedError = &microerror.Error{
+	Kind: "namespaceNotDeletedError",
+}
+
+// IsNamespaceNotDeleted asserts namespaceNotDeletedError.
+func IsNamespaceNotDeleted(err error) bool {
+	return microerror.Cause(err) == namespaceNotDeletedError
+}
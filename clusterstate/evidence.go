@@ -0,0 +1,175 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// nodeEvidence is a snapshot of the state of a node which changes when the
+// node restarts.
+type nodeEvidence struct {
+	uid        types.UID
+	bootID     string
+	ready      bool
+	readySince time.Time
+
+	// apiServerPods maps the UIDs of the API server pods running on the node
+	// to the sum of their container restart counts.
+	apiServerPods map[types.UID]int32
+}
+
+// collectEvidence returns snapshots of all nodes matching the given label
+// selector indexed by node name.
+func (c *ClusterState) collectEvidence(ctx context.Context, selector string) (map[string]nodeEvidence, error) {
+	nodes, err := c.k8sClient.K8sClient().CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	pods, err := c.k8sClient.K8sClient().CoreV1().Pods(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	evidence := map[string]nodeEvidence{}
+	for _, n := range nodes.Items {
+		e := nodeEvidence{
+			uid:           n.UID,
+			bootID:        n.Status.NodeInfo.BootID,
+			apiServerPods: map[types.UID]int32{},
+		}
+
+		for _, cond := range n.Status.Conditions {
+			if cond.Type == corev1.NodeReady {
+				e.ready = cond.Status == corev1.ConditionTrue
+				e.readySince = cond.LastTransitionTime.Time
+			}
+		}
+
+		evidence[n.Name] = e
+	}
+
+	for _, p := range pods.Items {
+		e, ok := evidence[p.Spec.NodeName]
+		if !ok || !isAPIServerPod(p) {
+			continue
+		}
+
+		var restarts int32
+		for _, s := range p.Status.ContainerStatuses {
+			restarts += s.RestartCount
+		}
+
+		e.apiServerPods[p.UID] = restarts
+	}
+
+	return evidence, nil
+}
+
+// waitForDisruptionEvidence waits for evidence that the given disruption
+// happened. Any difference between the given snapshots taken before the
+// disruption and the current state of the given disrupted nodes matching the
+// given label selector counts as evidence, see findDisruptionEvidence for
+// details. Observed API downtime only counts as evidence if apiDown is set,
+// i.e. all masters are disrupted. Otherwise the API is expected to stay
+// available and a short API blip does not prove that the disrupted node
+// restarted. Waiting for evidence instead of only waiting for downtime
+// prevents waiting for downtime which already happened in between two polls.
+func (c *ClusterState) waitForDisruptionEvidence(ctx context.Context, d *disruption, selector string, nodes []string, before map[string]nodeEvidence, apiDown bool) error {
+	o := func() error {
+		if apiDown && d.probe.observedDowntime() {
+			c.logger.LogCtx(ctx, "level", "debug", "message", "found disruption evidence: api was unavailable")
+			return nil
+		}
+
+		after, err := c.collectEvidence(ctx, selector)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		evidence, ok := findDisruptionEvidence(before, after, nodes, d.result.Started)
+		if !ok {
+			return microerror.Maskf(waitError, "no evidence of the disruption found yet")
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("found disruption evidence: %s", evidence))
+
+		return nil
+	}
+
+	b := backoff.NewConstant(c.disruptionEvidenceTimeout, 2*time.Second)
+	n := func(err error, delay time.Duration) {
+		c.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if IsWait(err) {
+		return microerror.Maskf(noDisruptionEvidenceError, "%s of %s within %s", d.result.Action, strings.Join(d.result.Targets, ", "), c.disruptionEvidenceTimeout)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// findDisruptionEvidence compares the given node snapshots taken before and
+// after the given start of a disruption. Only the given disrupted nodes are
+// looked at, so that unrelated changes of other nodes are not mistaken for
+// the disruption. Any of the following counts as evidence that the
+// disruption happened.
+//
+//   - A disrupted node is gone or got a new UID.
+//   - The boot ID of a disrupted node changed.
+//   - A disrupted node which was ready turned not ready, or it became ready
+//     after the disruption started, which shows that the kubelet restarted.
+//   - An API server pod on a disrupted node got recreated or one of its
+//     containers restarted.
+//
+// The returned string describes the evidence found.
+func findDisruptionEvidence(before, after map[string]nodeEvidence, nodes []string, started time.Time) (string, bool) {
+	for _, name := range nodes {
+		b, ok := before[name]
+		if !ok {
+			continue
+		}
+		a, ok := after[name]
+		if !ok {
+			return fmt.Sprintf("node %#q is gone", name), true
+		}
+		if a.uid != b.uid {
+			return fmt.Sprintf("node %#q got new UID %#q", name, a.uid), true
+		}
+		if a.bootID != b.bootID {
+			return fmt.Sprintf("node %#q got new boot ID %#q", name, a.bootID), true
+		}
+		if b.ready && !a.ready {
+			return fmt.Sprintf("node %#q turned not ready", name), true
+		}
+		if a.readySince.After(started) {
+			return fmt.Sprintf("node %#q became ready at %s", name, a.readySince), true
+		}
+		for uid, restarts := range b.apiServerPods {
+			r, ok := a.apiServerPods[uid]
+			if !ok {
+				return fmt.Sprintf("api server pod %#q on node %#q got recreated", uid, name), true
+			}
+			if r > restarts {
+				return fmt.Sprintf("api server pod %#q on node %#q restarted", uid, name), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func isAPIServerPod(p corev1.Pod) bool {
+	return strings.Contains(p.Name, "apiserver") || strings.Contains(p.Name, "api-server")
+}
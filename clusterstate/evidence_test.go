@@ -0,0 +1,272 @@
+package clusterstate
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+var errAPIDown = errors.New("api down")
+
+func Test_findDisruptionEvidence(t *testing.T) {
+	started := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	node := func(f func(e *nodeEvidence)) nodeEvidence {
+		e := nodeEvidence{
+			uid:        "uid-1",
+			bootID:     "boot-1",
+			ready:      true,
+			readySince: started.Add(-time.Hour),
+			apiServerPods: map[types.UID]int32{
+				"pod-1": 0,
+			},
+		}
+		if f != nil {
+			f(&e)
+		}
+		return e
+	}
+
+	notReady := node(func(e *nodeEvidence) { e.ready = false })
+
+	testCases := []struct {
+		name string
+		// before defaults to ready nodes master-1 and master-2. Only master-1
+		// is disrupted.
+		before        map[string]nodeEvidence
+		after         map[string]nodeEvidence
+		expectedFound bool
+	}{
+		{
+			name:          "case 0: nothing changed",
+			after:         map[string]nodeEvidence{"master-1": node(nil), "master-2": node(nil)},
+			expectedFound: false,
+		},
+		{
+			name:          "case 1: node is gone",
+			after:         map[string]nodeEvidence{"master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 2: new node joined",
+			after:         map[string]nodeEvidence{"master-1": node(nil), "master-2": node(nil), "master-3": node(nil)},
+			expectedFound: false,
+		},
+		{
+			name:          "case 3: node got new UID",
+			after:         map[string]nodeEvidence{"master-1": node(func(e *nodeEvidence) { e.uid = "uid-2" }), "master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 4: boot ID changed",
+			after:         map[string]nodeEvidence{"master-1": node(func(e *nodeEvidence) { e.bootID = "boot-2" }), "master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 5: node turned not ready",
+			after:         map[string]nodeEvidence{"master-1": notReady, "master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 6: node was not ready before",
+			before:        map[string]nodeEvidence{"master-1": notReady, "master-2": node(nil)},
+			after:         map[string]nodeEvidence{"master-1": notReady, "master-2": node(nil)},
+			expectedFound: false,
+		},
+		{
+			name:          "case 7: kubelet restarted",
+			after:         map[string]nodeEvidence{"master-1": node(func(e *nodeEvidence) { e.readySince = started.Add(time.Second) }), "master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 8: api server pod recreated",
+			after:         map[string]nodeEvidence{"master-1": node(func(e *nodeEvidence) { e.apiServerPods = map[types.UID]int32{"pod-2": 0} }), "master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 9: api server container restarted",
+			after:         map[string]nodeEvidence{"master-1": node(func(e *nodeEvidence) { e.apiServerPods = map[types.UID]int32{"pod-1": 1} }), "master-2": node(nil)},
+			expectedFound: true,
+		},
+		{
+			name:          "case 10: other node rebooted",
+			after:         map[string]nodeEvidence{"master-1": node(nil), "master-2": node(func(e *nodeEvidence) { e.bootID = "boot-2" })},
+			expectedFound: false,
+		},
+		{
+			name:          "case 11: other node turned not ready",
+			after:         map[string]nodeEvidence{"master-1": node(nil), "master-2": notReady},
+			expectedFound: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			before := tc.before
+			if before == nil {
+				before = map[string]nodeEvidence{"master-1": node(nil), "master-2": node(nil)}
+			}
+
+			evidence, found := findDisruptionEvidence(before, tc.after, []string{"master-1"}, started)
+			if found != tc.expectedFound {
+				t.Fatalf("%s: found == %t (%q), want %t", tc.name, found, evidence, tc.expectedFound)
+			}
+		})
+	}
+}
+
+func Test_ClusterState_waitForDisruptionEvidence(t *testing.T) {
+	testCases := []struct {
+		name    string
+		step    Step
+		disrupt func(k8sClient kubernetes.Interface) func(ctx context.Context, method, id string) error
+		// apiDown makes the API unavailable for the API probe.
+		apiDown      bool
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: master rebooted",
+			step:         RebootMasters(),
+			disrupt:      rebootNodes,
+			errorMatcher: nil,
+		},
+		{
+			name:         "case 1: master reboot not observable",
+			step:         RebootMasters(),
+			disrupt:      nil,
+			errorMatcher: IsNoDisruptionEvidence,
+		},
+		{
+			name:         "case 2: api downtime proves reboot of all masters",
+			step:         RebootMasters(),
+			disrupt:      waitForAPIProbe,
+			apiDown:      true,
+			errorMatcher: nil,
+		},
+		{
+			name:         "case 3: api downtime does not prove worker reboot",
+			step:         RebootWorker(),
+			disrupt:      waitForAPIProbe,
+			apiDown:      true,
+			errorMatcher: IsNoDisruptionEvidence,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(newMasterNode("master-m1"), newWorkerNode("worker-w1"))
+			if tc.apiDown {
+				k8sClient.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errAPIDown
+				})
+			}
+
+			var disrupt func(ctx context.Context, method, id string) error
+			if tc.disrupt != nil {
+				disrupt = tc.disrupt(k8sClient)
+			}
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{Masters: []string{"m1"}, Workers: []string{"w1"}, Disrupt: disrupt}),
+
+				DisruptionEvidenceTimeout: 10 * time.Millisecond,
+				HealthGate:                HealthGateConfig{Disabled: true},
+				Scenario: &Scenario{
+					Name:  "disrupt",
+					Steps: []Step{tc.step},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.Test(context.Background())
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+		})
+	}
+}
+
+func newMasterNode(name string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"node-role.kubernetes.io/master": "",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			},
+			NodeInfo: corev1.NodeSystemInfo{
+				BootID: rand.String(8),
+			},
+		},
+	}
+}
+
+func newWorkerNode(name string) *corev1.Node {
+	n := newMasterNode(name)
+	n.Labels = map[string]string{
+		"node-role.kubernetes.io/worker": "",
+	}
+
+	return n
+}
+
+// waitForAPIProbe returns a providertest disruption function which does not
+// change any node but gives the API probe time to observe API downtime.
+func waitForAPIProbe(k8sClient kubernetes.Interface) func(ctx context.Context, method, id string) error {
+	return func(ctx context.Context, method, id string) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+}
+
+// rebootNodes returns a providertest disruption function which gives all
+// nodes a new boot ID, like a reboot would.
+func rebootNodes(k8sClient kubernetes.Interface) func(ctx context.Context, method, id string) error {
+	return func(ctx context.Context, method, id string) error {
+		l, err := k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, n := range l.Items {
+			n.Status.NodeInfo.BootID = rand.String(8)
+			_, err = k8sClient.CoreV1().Nodes().Update(ctx, &n, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package clusterstate
+
+import (
+	"context"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ LegacyFramework = &NativeFramework{}
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+type NativeFrameworkConfig struct {
+	K8sClient k8sclient.Interface
+	Logger    micrologger.Logger
+}
+
+// NativeFramework implements LegacyFramework using the tenant cluster
+// Kubernetes API only. It is used by default when Config.LegacyFramework is
+// not set.
+type NativeFramework struct {
+	k8sClient k8sclient.Interface
+	logger    micrologger.Logger
+}
+
+func NewNativeFramework(config NativeFrameworkConfig) (*NativeFramework, error) {
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	f := &NativeFramework{
+		k8sClient: config.K8sClient,
+		logger:    config.Logger,
+	}
+
+	return f, nil
+}
+
+// WaitForAPIDown waits for the /healthz endpoint of the tenant cluster
+// Kubernetes API to fail.
+func (f *NativeFramework) WaitForAPIDown() error {
+	ctx := context.Background()
+
+	o := func() error {
+		err := f.checkEndpoint(ctx, healthzPath)
+		if err == nil {
+			return microerror.Maskf(waitError, "api is still up")
+		}
+
+		return nil
+	}
+
+	b := backoff.NewConstant(backoff.ShortMaxWait, 2*time.Second)
+	n := func(err error, delay time.Duration) {
+		f.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// WaitForGuestReady waits for the /readyz endpoint of the tenant cluster
+// Kubernetes API to succeed, all nodes to be ready and all pods in the
+// kube-system namespace to be ready.
+func (f *NativeFramework) WaitForGuestReady(ctx context.Context) error {
+	o := func() error {
+		err := f.checkEndpoint(ctx, readyzPath)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = f.checkNodesReady(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = f.checkSystemPodsReady(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	n := func(err error, delay time.Duration) {
+		f.logger.LogCtx(ctx, "level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (f *NativeFramework) checkEndpoint(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, apiProbeTimeout)
+	defer cancel()
+
+	body, err := f.k8sClient.K8sClient().Discovery().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+	if err != nil {
+		return microerror.Maskf(waitError, "%s failed: %s", path, err)
+	}
+	if string(body) != "ok" {
+		return microerror.Maskf(waitError, "%s returned %#q", path, body)
+	}
+
+	return nil
+}
+
+func (f *NativeFramework) checkNodesReady(ctx context.Context) error {
+	l, err := f.k8sClient.K8sClient().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if len(l.Items) == 0 {
+		return microerror.Maskf(waitError, "no nodes registered")
+	}
+
+	for _, n := range l.Items {
+		if !isNodeReady(n) {
+			return microerror.Maskf(waitError, "node %#q is not ready", n.Name)
+		}
+	}
+
+	return nil
+}
+
+func (f *NativeFramework) checkSystemPodsReady(ctx context.Context) error {
+	l, err := f.k8sClient.K8sClient().CoreV1().Pods(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for _, p := range l.Items {
+		if p.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		if !isPodReady(p) {
+			return microerror.Maskf(waitError, "pod %#q in namespace %#q is not ready", p.Name, p.Namespace)
+		}
+	}
+
+	return nil
+}
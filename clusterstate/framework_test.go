@@ -0,0 +1,168 @@
+package clusterstate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func Test_NativeFramework_checkEndpoint(t *testing.T) {
+	testCases := []struct {
+		name         string
+		status       int
+		body         string
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: endpoint is ok",
+			status:       http.StatusOK,
+			body:         "ok",
+			errorMatcher: nil,
+		},
+		{
+			name:         "case 1: endpoint fails",
+			status:       http.StatusInternalServerError,
+			body:         "[-]etcd failed: reason withheld",
+			errorMatcher: IsWait,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != readyzPath {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			k8sClient, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			f, err := NewNativeFramework(NativeFrameworkConfig{
+				K8sClient: k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				Logger:    microloggertest.New(),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = f.checkEndpoint(context.Background(), readyzPath)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+		})
+	}
+}
+
+func Test_NativeFramework_checkReady(t *testing.T) {
+	readyNode := func(name string, status corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{
+					{Type: corev1.NodeReady, Status: status},
+				},
+			},
+		}
+	}
+	systemPod := func(name string, phase corev1.PodPhase, status corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem},
+			Status: corev1.PodStatus{
+				Phase: phase,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: status},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		objects      []runtime.Object
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: nodes and system pods are ready",
+			objects: []runtime.Object{
+				readyNode("master", corev1.ConditionTrue),
+				readyNode("worker", corev1.ConditionTrue),
+				systemPod("coredns", corev1.PodRunning, corev1.ConditionTrue),
+				systemPod("job", corev1.PodSucceeded, corev1.ConditionFalse),
+			},
+			errorMatcher: nil,
+		},
+		{
+			name:         "case 1: no nodes",
+			objects:      nil,
+			errorMatcher: IsWait,
+		},
+		{
+			name: "case 2: node not ready",
+			objects: []runtime.Object{
+				readyNode("master", corev1.ConditionTrue),
+				readyNode("worker", corev1.ConditionUnknown),
+			},
+			errorMatcher: IsWait,
+		},
+		{
+			name: "case 3: system pod not ready",
+			objects: []runtime.Object{
+				readyNode("master", corev1.ConditionTrue),
+				systemPod("coredns", corev1.PodRunning, corev1.ConditionFalse),
+			},
+			errorMatcher: IsWait,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			f, err := NewNativeFramework(NativeFrameworkConfig{
+				K8sClient: k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: fake.NewSimpleClientset(tc.objects...)}),
+				Logger:    microloggertest.New(),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = f.checkNodesReady(ctx)
+			if err == nil {
+				err = f.checkSystemPodsReady(ctx)
+			}
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+		})
+	}
+}
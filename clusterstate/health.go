@@ -0,0 +1,486 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	coreDNSLabelSelector = "k8s-app=coredns"
+
+	healthProbeImage     = "quay.io/giantswarm/busybox:1.32.0"
+	healthProbeNamespace = "e2e-health"
+	healthProbeServer    = "e2e-health-server"
+	healthProbePort      = 8080
+	// healthProbeAttempts is the number of times the probe pod resolves and
+	// requests the probe server before it fails, so that short DNS or
+	// service routing hiccups right after a recovery do not fail the gate.
+	healthProbeAttempts = 10
+
+	// stuckPodThreshold is the time after which pods still terminating past
+	// their grace period are considered stuck.
+	stuckPodThreshold = 2 * time.Minute
+)
+
+// ComponentHealth is the health of a single tenant cluster component checked
+// by the health gate.
+type ComponentHealth struct {
+	// Component is the name of the component, e.g. "coredns" or
+	// "daemonset/kube-proxy".
+	Component string
+	Healthy   bool
+	// Message describes why the component is unhealthy.
+	Message string
+}
+
+// HealthCheck is the result of a single health gate run.
+type HealthCheck struct {
+	Time       time.Time
+	Components []ComponentHealth
+}
+
+// Unhealthy returns the names of all unhealthy components.
+func (h HealthCheck) Unhealthy() []string {
+	var names []string
+	for _, c := range h.Components {
+		if !c.Healthy {
+			names = append(names, c.Component)
+		}
+	}
+
+	return names
+}
+
+// runHealthGate waits for all tenant cluster components to be healthy and
+// verifies cluster DNS and service routing from a probe pod. The result of
+// every component is logged and added to the given state.
+func (c *ClusterState) runHealthGate(ctx context.Context, state *State) error {
+	var components []ComponentHealth
+	{
+		o := func() error {
+			var err error
+
+			components, err = c.checkComponents(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			for _, h := range components {
+				if !h.Healthy {
+					return microerror.Maskf(waitError, "%s is unhealthy: %s", h.Component, h.Message)
+				}
+			}
+
+			return nil
+		}
+
+		b := backoff.NewConstant(backoff.ShortMaxWait, backoff.ShortMaxInterval)
+		n := func(err error, delay time.Duration) {
+			c.logger.Log("level", "debug", "message", err.Error())
+		}
+
+		err := backoff.RetryNotify(o, b, n)
+		if IsWait(err) {
+			// Fall through to report all components.
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		if !state.healthProbeInstalled {
+			state.AddCleanup(c.deleteHealthProbe)
+			state.healthProbeInstalled = true
+		}
+
+		h, err := c.probeDNSAndServiceRouting(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		components = append(components, h)
+	}
+
+	check := HealthCheck{
+		Time:       time.Now(),
+		Components: components,
+	}
+	state.result.HealthChecks = append(state.result.HealthChecks, check)
+
+	for _, h := range check.Components {
+		if h.Healthy {
+			c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("component %#q is healthy", h.Component))
+		} else {
+			c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("component %#q is unhealthy: %s", h.Component, h.Message))
+		}
+	}
+
+	unhealthy := check.Unhealthy()
+	if len(unhealthy) > 0 {
+		return microerror.Maskf(unhealthyComponentsError, "%s", strings.Join(unhealthy, ", "))
+	}
+
+	return nil
+}
+
+// checkComponents checks that all nodes are ready, CoreDNS is available, all
+// DaemonSets in kube-system, e.g. kube-proxy and the CNI, are fully rolled
+// out and no pods are stuck terminating or in an unknown phase.
+func (c *ClusterState) checkComponents(ctx context.Context) ([]ComponentHealth, error) {
+	var components []ComponentHealth
+
+	{
+		l, err := c.k8sClient.K8sClient().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		h := ComponentHealth{Component: "nodes", Healthy: true}
+		var notReady []string
+		for _, n := range l.Items {
+			if !isNodeReady(n) {
+				notReady = append(notReady, n.Name)
+			}
+		}
+		if len(l.Items) == 0 {
+			h.Healthy, h.Message = false, "no nodes registered"
+		} else if len(notReady) > 0 {
+			h.Healthy, h.Message = false, fmt.Sprintf("nodes %s are not ready", strings.Join(notReady, ", "))
+		}
+
+		components = append(components, h)
+	}
+
+	{
+		l, err := c.k8sClient.K8sClient().AppsV1().Deployments(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{LabelSelector: coreDNSLabelSelector})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		h := ComponentHealth{Component: "coredns", Healthy: true}
+		if len(l.Items) == 0 {
+			h.Healthy, h.Message = false, fmt.Sprintf("no deployment matching %#q found", coreDNSLabelSelector)
+		}
+		for _, d := range l.Items {
+			var desired int32 = 1
+			if d.Spec.Replicas != nil {
+				desired = *d.Spec.Replicas
+			}
+			if d.Status.AvailableReplicas < desired {
+				h.Healthy, h.Message = false, fmt.Sprintf("deployment %#q has %d available replicas, want %d", d.Name, d.Status.AvailableReplicas, desired)
+			}
+		}
+
+		components = append(components, h)
+	}
+
+	{
+		l, err := c.k8sClient.K8sClient().AppsV1().DaemonSets(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		sort.Slice(l.Items, func(i, j int) bool { return l.Items[i].Name < l.Items[j].Name })
+
+		for _, d := range l.Items {
+			h := ComponentHealth{Component: fmt.Sprintf("daemonset/%s", d.Name), Healthy: true}
+
+			desired := d.Status.DesiredNumberScheduled
+			if d.Status.ObservedGeneration < d.Generation {
+				h.Healthy, h.Message = false, "rollout not observed yet"
+			} else if d.Status.UpdatedNumberScheduled < desired {
+				h.Healthy, h.Message = false, fmt.Sprintf("%d of %d pods updated", d.Status.UpdatedNumberScheduled, desired)
+			} else if d.Status.NumberAvailable < desired {
+				h.Healthy, h.Message = false, fmt.Sprintf("%d of %d pods available", d.Status.NumberAvailable, desired)
+			}
+
+			components = append(components, h)
+		}
+	}
+
+	{
+		l, err := c.k8sClient.K8sClient().CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		h := ComponentHealth{Component: "pods", Healthy: true}
+		var stuck []string
+		for _, p := range l.Items {
+			if isPodStuck(p, time.Now()) {
+				stuck = append(stuck, fmt.Sprintf("%s/%s", p.Namespace, p.Name))
+			}
+		}
+		if len(stuck) > 0 {
+			sort.Strings(stuck)
+			h.Healthy, h.Message = false, fmt.Sprintf("pods %s are stuck terminating or unknown", strings.Join(stuck, ", "))
+		}
+
+		components = append(components, h)
+	}
+
+	return components, nil
+}
+
+// probeDNSAndServiceRouting runs a probe pod resolving the name of a service
+// backed by a small HTTP server and requesting the server through the service.
+// The server deployment and the service are created once and reused by later
+// runs. The probe pod is only created once the service has ready endpoints,
+// e.g. after the server got rescheduled by draining its node, and retries
+// resolving and requesting the server a few times.
+func (c *ClusterState) probeDNSAndServiceRouting(ctx context.Context) (ComponentHealth, error) {
+	h := ComponentHealth{Component: "dns-and-service-routing", Healthy: true}
+
+	err := c.ensureHealthProbeServer(ctx)
+	if err != nil {
+		return ComponentHealth{}, microerror.Mask(err)
+	}
+
+	{
+		o := func() error {
+			e, err := c.k8sClient.K8sClient().CoreV1().Endpoints(healthProbeNamespace).Get(ctx, healthProbeServer, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return microerror.Maskf(waitError, "service %#q has no endpoints", healthProbeServer)
+			} else if err != nil {
+				return microerror.Mask(err)
+			}
+
+			for _, s := range e.Subsets {
+				if len(s.Addresses) > 0 {
+					return nil
+				}
+			}
+
+			return microerror.Maskf(waitError, "service %#q has no ready endpoints", healthProbeServer)
+		}
+
+		b := backoff.NewConstant(backoff.ShortMaxWait, backoff.ShortMaxInterval)
+		n := func(err error, delay time.Duration) {
+			c.logger.Log("level", "debug", "message", err.Error())
+		}
+
+		err := backoff.RetryNotify(o, b, n)
+		if IsWait(err) {
+			h.Healthy, h.Message = false, fmt.Sprintf("service %#q has no ready endpoints", healthProbeServer)
+			return h, nil
+		} else if err != nil {
+			return ComponentHealth{}, microerror.Mask(err)
+		}
+	}
+
+	name := fmt.Sprintf("e2e-health-probe-%s", rand.String(5))
+	host := fmt.Sprintf("%s.%s.svc.%s", healthProbeServer, healthProbeNamespace, c.healthGate.ClusterDomain)
+
+	{
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: healthProbeNamespace,
+			},
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers: []corev1.Container{
+					{
+						Name:    "probe",
+						Image:   healthProbeImage,
+						Command: []string{"sh", "-c", probeScript(host)},
+					},
+				},
+			},
+		}
+
+		_, err := c.k8sClient.K8sClient().CoreV1().Pods(healthProbeNamespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			return ComponentHealth{}, microerror.Mask(err)
+		}
+
+		defer func() {
+			err := c.k8sClient.K8sClient().CoreV1().Pods(healthProbeNamespace).Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				c.logger.LogCtx(ctx, "level", "error", "message", fmt.Sprintf("failed to delete health probe pod %#q", name), "stack", fmt.Sprintf("%#v", err))
+			}
+		}()
+	}
+
+	var phase corev1.PodPhase
+	{
+		o := func() error {
+			pod, err := c.k8sClient.K8sClient().CoreV1().Pods(healthProbeNamespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			phase = pod.Status.Phase
+			if phase != corev1.PodSucceeded && phase != corev1.PodFailed {
+				return microerror.Maskf(waitError, "health probe pod %#q is %#q", name, phase)
+			}
+
+			return nil
+		}
+
+		// The probe retries for up to healthProbeAttempts times 15 seconds,
+		// so the pod gets more time than the other health checks.
+		b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+		n := func(err error, delay time.Duration) {
+			c.logger.Log("level", "debug", "message", err.Error())
+		}
+
+		err := backoff.RetryNotify(o, b, n)
+		if IsWait(err) {
+			// Fall through to report the probe as unhealthy.
+		} else if err != nil {
+			return ComponentHealth{}, microerror.Mask(err)
+		}
+	}
+
+	if phase != corev1.PodSucceeded {
+		h.Healthy, h.Message = false, fmt.Sprintf("probe pod resolving and requesting %#q is %#q", host, phase)
+	}
+
+	return h, nil
+}
+
+func (c *ClusterState) ensureHealthProbeServer(ctx context.Context) error {
+	labels := map[string]string{
+		"app": healthProbeServer,
+	}
+
+	objects := []func() error{
+		func() error {
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: healthProbeNamespace,
+				},
+			}
+
+			_, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+			return err
+		},
+		func() error {
+			replicas := int32(1)
+
+			d := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      healthProbeServer,
+					Namespace: healthProbeNamespace,
+					Labels:    labels,
+				},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{
+						MatchLabels: labels,
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: labels,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "server",
+									Image: healthProbeImage,
+									Command: []string{
+										"sh", "-c", fmt.Sprintf("mkdir -p /www && echo ok > /www/index.html && exec httpd -f -p %d -h /www", healthProbePort),
+									},
+									ReadinessProbe: &corev1.Probe{
+										Handler: corev1.Handler{
+											TCPSocket: &corev1.TCPSocketAction{
+												Port: intstr.FromInt(healthProbePort),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			_, err := c.k8sClient.K8sClient().AppsV1().Deployments(healthProbeNamespace).Create(ctx, d, metav1.CreateOptions{})
+			return err
+		},
+		func() error {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      healthProbeServer,
+					Namespace: healthProbeNamespace,
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: labels,
+					Ports: []corev1.ServicePort{
+						{
+							Port:       healthProbePort,
+							TargetPort: intstr.FromInt(healthProbePort),
+						},
+					},
+				},
+			}
+
+			_, err := c.k8sClient.K8sClient().CoreV1().Services(healthProbeNamespace).Create(ctx, svc, metav1.CreateOptions{})
+			return err
+		},
+	}
+
+	for _, create := range objects {
+		err := create()
+		if apierrors.IsAlreadyExists(err) {
+			// Fall through.
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// deleteHealthProbe deletes the health probe namespace including the probe
+// server and service and waits for the namespace to be gone.
+func (c *ClusterState) deleteHealthProbe(ctx context.Context) error {
+	err := c.deleteNamespace(ctx, healthProbeNamespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// probeScript returns the script of the probe pod resolving and requesting
+// the given host. It tries healthProbeAttempts times and succeeds as soon as
+// one attempt succeeds.
+func probeScript(host string) string {
+	return fmt.Sprintf(
+		"for i in $(seq %[1]d); do nslookup %[2]s && wget -q -T 5 -O - http://%[2]s:%[3]d/ && exit 0; sleep 10; done; exit 1",
+		healthProbeAttempts, host, healthProbePort,
+	)
+}
+
+// isPodStuck returns true if the given pod is in an unknown phase or still
+// terminating long after its grace period ended.
+func isPodStuck(p corev1.Pod, now time.Time) bool {
+	if p.Status.Phase == corev1.PodUnknown {
+		return true
+	}
+
+	if p.DeletionTimestamp == nil {
+		return false
+	}
+
+	deadline := p.DeletionTimestamp.Time.Add(stuckPodThreshold)
+	if p.DeletionGracePeriodSeconds != nil {
+		deadline = deadline.Add(time.Duration(*p.DeletionGracePeriodSeconds) * time.Second)
+	}
+
+	return now.After(deadline)
+}
@@ -0,0 +1,242 @@
+package clusterstate
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+func Test_ClusterState_checkComponents(t *testing.T) {
+	coreDNS := func(available int32) runtime.Object {
+		replicas := int32(2)
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "coredns",
+				Namespace: metav1.NamespaceSystem,
+				Labels: map[string]string{
+					"k8s-app": "coredns",
+				},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+			},
+			Status: appsv1.DeploymentStatus{
+				AvailableReplicas: available,
+			},
+		}
+	}
+	daemonSet := func(name string, updated, available int32) runtime.Object {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: metav1.NamespaceSystem,
+			},
+			Status: appsv1.DaemonSetStatus{
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: updated,
+				NumberAvailable:        available,
+			},
+		}
+	}
+	pod := func(name string, phase corev1.PodPhase, deleted time.Duration) runtime.Object {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Status: corev1.PodStatus{
+				Phase: phase,
+			},
+		}
+		if deleted != 0 {
+			t := metav1.NewTime(time.Now().Add(-deleted))
+			p.DeletionTimestamp = &t
+		}
+		return p
+	}
+	notReadyNode := func(name string) runtime.Object {
+		n := newMasterNode(name)
+		n.Status.Conditions[0].Status = corev1.ConditionFalse
+		return n
+	}
+
+	testCases := []struct {
+		name               string
+		objects            []runtime.Object
+		expectedComponents []ComponentHealth
+	}{
+		{
+			name: "case 0: all components healthy",
+			objects: []runtime.Object{
+				newMasterNode("master-1"),
+				coreDNS(2),
+				daemonSet("calico-node", 3, 3),
+				daemonSet("kube-proxy", 3, 3),
+				pod("running", corev1.PodRunning, 0),
+				pod("terminating", corev1.PodRunning, 10*time.Second),
+			},
+			expectedComponents: []ComponentHealth{
+				{Component: "nodes", Healthy: true},
+				{Component: "coredns", Healthy: true},
+				{Component: "daemonset/calico-node", Healthy: true},
+				{Component: "daemonset/kube-proxy", Healthy: true},
+				{Component: "pods", Healthy: true},
+			},
+		},
+		{
+			name: "case 1: every component unhealthy",
+			objects: []runtime.Object{
+				newMasterNode("master-1"),
+				notReadyNode("master-2"),
+				coreDNS(1),
+				daemonSet("calico-node", 3, 2),
+				daemonSet("kube-proxy", 2, 3),
+				pod("unknown", corev1.PodUnknown, 0),
+				pod("stuck", corev1.PodRunning, 10*time.Minute),
+			},
+			expectedComponents: []ComponentHealth{
+				{Component: "nodes", Message: "nodes master-2 are not ready"},
+				{Component: "coredns", Message: "deployment `coredns` has 1 available replicas, want 2"},
+				{Component: "daemonset/calico-node", Message: "2 of 3 pods available"},
+				{Component: "daemonset/kube-proxy", Message: "2 of 3 pods updated"},
+				{Component: "pods", Message: "pods default/stuck, default/unknown are stuck terminating or unknown"},
+			},
+		},
+		{
+			name:    "case 2: missing nodes and coredns",
+			objects: []runtime.Object{},
+			expectedComponents: []ComponentHealth{
+				{Component: "nodes", Message: "no nodes registered"},
+				{Component: "coredns", Message: "no deployment matching `k8s-app=coredns` found"},
+				{Component: "pods", Healthy: true},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(tc.objects...)
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{}),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			components, err := c.checkComponents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			if !reflect.DeepEqual(components, tc.expectedComponents) {
+				t.Fatalf("%s: components == %#v, want %#v", tc.name, components, tc.expectedComponents)
+			}
+		})
+	}
+}
+
+func Test_ClusterState_probeDNSAndServiceRouting(t *testing.T) {
+	testCases := []struct {
+		name string
+		// notReadyGets is the number of times the endpoints of the probe
+		// server are not ready yet.
+		notReadyGets      int
+		expectedComponent ComponentHealth
+		expectedGets      int
+	}{
+		{
+			name:              "case 0: endpoints ready",
+			notReadyGets:      0,
+			expectedComponent: ComponentHealth{Component: "dns-and-service-routing", Healthy: true},
+			expectedGets:      1,
+		},
+		{
+			name:              "case 1: probe waits for endpoints to be ready",
+			notReadyGets:      1,
+			expectedComponent: ComponentHealth{Component: "dns-and-service-routing", Healthy: true},
+			expectedGets:      2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			cluster := clusterstatetest.NewCluster(clusterstatetest.ClusterConfig{
+				Masters: []string{"m1"},
+				Workers: []string{"w1"},
+			})
+
+			var gets int
+			cluster.K8sClient().PrependReactor("get", "endpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				gets++
+				if gets > tc.notReadyGets {
+					return false, nil, nil
+				}
+
+				e := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      healthProbeServer,
+						Namespace: healthProbeNamespace,
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+						},
+					},
+				}
+				return true, e, nil
+			})
+			var getsBeforeProbe int
+			cluster.K8sClient().PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				getsBeforeProbe = gets
+				return false, nil, nil
+			})
+
+			c, err := New(Config{
+				K8sClient:       cluster.Clients(),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{}),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			h, err := c.probeDNSAndServiceRouting(ctx)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(h, tc.expectedComponent) {
+				t.Fatalf("%s: component == %#v, want %#v", tc.name, h, tc.expectedComponent)
+			}
+			if getsBeforeProbe != tc.expectedGets {
+				t.Fatalf("%s: endpoints got %d times before creating the probe pod, want %d", tc.name, getsBeforeProbe, tc.expectedGets)
+			}
+
+			_, err = cluster.K8sClient().AppsV1().Deployments(healthProbeNamespace).Get(ctx, healthProbeServer, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s: probe server deployment: unexpected error %#v", tc.name, err)
+			}
+		})
+	}
+}
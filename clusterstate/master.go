@@ -0,0 +1,227 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/giantswarm/microerror"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// disruptMasters applies the given disruption to the masters identified by the
+// given IDs and checks the cluster state after every recovery. Single master
+// clusters and the MasterDisruptionAll mode disrupt all masters at once and
+// expect the API to go down. The disruption itself is detected using restart
+// evidence, see waitForDisruptionEvidence. HA clusters in the
+// MasterDisruptionOneByOne mode disrupt one master at a time and expect the
+// API to stay available. The results of all disruptions are added to the given
+// state.
+func (c *ClusterState) disruptMasters(ctx context.Context, state *State, ids []string, action string, disrupt func(ctx context.Context, id string) error) error {
+	if len(ids) == 1 || c.masterDisruption == MasterDisruptionAll {
+		err := c.disruptAllMasters(ctx, state, ids, action, disrupt)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+
+	for _, id := range ids {
+		err := c.disruptMaster(ctx, state, id, len(ids), action, disrupt)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+func (c *ClusterState) disruptAllMasters(ctx context.Context, state *State, ids []string, action string, disrupt func(ctx context.Context, id string) error) error {
+	nodes, err := c.nodeNames(ctx, ids, c.provider.MasterNodeName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	before, err := c.collectEvidence(ctx, masterNodeLabelSelector)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	d := c.startDisruption(ctx, fmt.Sprintf("%s master", action), ids...)
+	defer d.ready()
+
+	for _, id := range ids {
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("%s master %#q", action, id))
+
+		err = disrupt(ctx, id)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for evidence of the master disruption")
+
+		err = c.waitForDisruptionEvidence(ctx, d, masterNodeLabelSelector, nodes, before, true)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "masters are disrupted")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for guest cluster")
+
+		err = c.legacyFramework.WaitForGuestReady(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "guest cluster ready")
+	}
+
+	err = c.recordDisruption(ctx, state, d.ready())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking cluster state")
+
+		err = c.checkClusterState(ctx, state)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cluster state is intact")
+	}
+
+	return nil
+}
+
+func (c *ClusterState) disruptMaster(ctx context.Context, state *State, id string, num int, action string, disrupt func(ctx context.Context, id string) error) error {
+	nodes, err := c.nodeNames(ctx, []string{id}, c.provider.MasterNodeName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	before, err := c.collectEvidence(ctx, masterNodeLabelSelector)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	d := c.startDisruption(ctx, fmt.Sprintf("%s master", action), id)
+	defer d.ready()
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("%s master %#q", action, id))
+
+		err = disrupt(ctx, id)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for evidence of the master disruption")
+
+		err = c.waitForDisruptionEvidence(ctx, d, masterNodeLabelSelector, nodes, before, false)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "master node is disrupted")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for master nodes to be ready")
+
+		err = c.waitForNodesReady(ctx, masterNodeLabelSelector, num)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "master nodes are ready")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for guest cluster")
+
+		err = c.legacyFramework.WaitForGuestReady(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "guest cluster ready")
+	}
+
+	result := d.ready()
+
+	err = c.recordDisruption(ctx, state, result)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking api stayed available")
+
+		unavailable := result.LongestDowntime()
+		if unavailable > c.maxAPIUnavailability {
+			return microerror.Maskf(apiUnavailableError, "api was unavailable for %s while %s master %#q, allowed are %s", unavailable, action, id, c.maxAPIUnavailability)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("api stayed available, longest unavailability was %s", unavailable))
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking cluster state")
+
+		err = c.checkClusterState(ctx, state)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cluster state is intact")
+	}
+
+	return nil
+}
+
+// findMasterNodes returns the UIDs of the tenant cluster master nodes indexed
+// by node name.
+func (c *ClusterState) findMasterNodes(ctx context.Context) (map[string]types.UID, error) {
+	nodes, err := c.findNodes(ctx, masterNodeLabelSelector)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if len(nodes) == 0 {
+		return nil, microerror.Maskf(notFoundError, "master nodes")
+	}
+
+	return nodes, nil
+}
+
+// verifyMastersReplaced ensures that none of the current master nodes has the
+// node name or UID of any of the given master nodes found before the
+// replacement.
+func (c *ClusterState) verifyMastersReplaced(ctx context.Context, before map[string]types.UID) error {
+	after, err := c.findMasterNodes(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	uids := map[types.UID]bool{}
+	for _, uid := range before {
+		uids[uid] = true
+	}
+
+	for name, uid := range after {
+		_, nameExisted := before[name]
+		if nameExisted || uids[uid] {
+			return microerror.Maskf(masterNotReplacedError, "master node %#q with UID %#q existed before", name, uid)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteManagedNamespace deletes the namespace of the given name like
+// deleteNamespace if it carries the managed-by label, i.e. it was created by
+// the cluster state test. Namespaces shared with other workloads are kept.
+func (c *ClusterState) deleteManagedNamespace(ctx context.Context, name string) error {
+	ns, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if ns.Labels[managedByLabel] != managedByValue {
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("keeping namespace %#q not created by the test", name))
+		return nil
+	}
+
+	err = c.deleteNamespace(ctx, name)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// deleteNamespace deletes the namespace of the given name and waits for it to
+// finish terminating, so that rerunning the test does not collide on a
+// terminating namespace.
+func (c *ClusterState) deleteNamespace(ctx context.Context, name string) error {
+	err := c.k8sClient.K8sClient().CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	o := func() error {
+		_, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return microerror.Maskf(namespaceNotDeletedError, "namespace %#q is still terminating", name)
+	}
+
+	n := func(err error, t time.Duration) {
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for namespace %#q to be deleted: retrying in %s", name, t))
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	err = backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
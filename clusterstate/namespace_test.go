@@ -0,0 +1,160 @@
+package clusterstate
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+func Test_ClusterState_deleteNamespace(t *testing.T) {
+	testCases := []struct {
+		name    string
+		objects []runtime.Object
+		// terminating keeps deleted namespaces terminating until they are
+		// read once.
+		terminating bool
+	}{
+		{
+			name: "case 0: namespace does not exist",
+		},
+		{
+			name: "case 1: namespace is deleted",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			},
+		},
+		{
+			name: "case 2: namespace finishes terminating",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			},
+			terminating: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			k8sClient := fake.NewSimpleClientset(tc.objects...)
+			if tc.terminating {
+				namespaces := corev1.SchemeGroupVersion.WithResource("namespaces")
+
+				k8sClient.PrependReactor("delete", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					obj, err := k8sClient.Tracker().Get(namespaces, "", action.(k8stesting.DeleteAction).GetName())
+					if err != nil {
+						return false, nil, nil
+					}
+
+					ns := obj.(*corev1.Namespace)
+					ns.Status.Phase = corev1.NamespaceTerminating
+
+					return true, nil, k8sClient.Tracker().Update(namespaces, ns, "")
+				})
+				k8sClient.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					obj, err := k8sClient.Tracker().Get(namespaces, "", action.(k8stesting.GetAction).GetName())
+					if err != nil {
+						return false, nil, nil
+					}
+
+					if obj.(*corev1.Namespace).Status.Phase == corev1.NamespaceTerminating {
+						_ = k8sClient.Tracker().Delete(namespaces, "", action.(k8stesting.GetAction).GetName())
+						return true, obj, nil
+					}
+
+					return false, nil, nil
+				})
+			}
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{}),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.deleteNamespace(ctx, "test")
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+
+			_, err = k8sClient.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+			if !apierrors.IsNotFound(err) {
+				t.Fatalf("%s: namespace error == %#v, want not found", tc.name, err)
+			}
+		})
+	}
+}
+
+func Test_ClusterState_deleteManagedNamespace(t *testing.T) {
+	testCases := []struct {
+		name              string
+		objects           []runtime.Object
+		expectedNamespace bool
+	}{
+		{
+			name:              "case 0: namespace does not exist",
+			expectedNamespace: false,
+		},
+		{
+			name: "case 1: namespace created by the test is deleted",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{managedByLabel: managedByValue}}},
+			},
+			expectedNamespace: false,
+		},
+		{
+			name: "case 2: shared namespace is kept",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			},
+			expectedNamespace: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			k8sClient := fake.NewSimpleClientset(tc.objects...)
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{}),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.deleteManagedNamespace(ctx, "test")
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+
+			_, err = k8sClient.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+			if tc.expectedNamespace && err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+			if !tc.expectedNamespace && !apierrors.IsNotFound(err) {
+				t.Fatalf("%s: namespace error == %#v, want not found", tc.name, err)
+			}
+		})
+	}
+}
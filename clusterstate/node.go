@@ -0,0 +1,104 @@
+package clusterstate
+
+import (
+	"context"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// findNodes returns the UIDs of the tenant cluster nodes matching the given
+// label selector indexed by node name.
+func (c *ClusterState) findNodes(ctx context.Context, selector string) (map[string]types.UID, error) {
+	lo := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	l, err := c.k8sClient.K8sClient().CoreV1().Nodes().List(ctx, lo)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	nodes := map[string]types.UID{}
+	for _, n := range l.Items {
+		nodes[n.Name] = n.UID
+	}
+
+	return nodes, nil
+}
+
+// nodeNames returns the names of the tenant cluster nodes of the given
+// provider IDs using the given lookup, e.g. provider.Interface.MasterNodeName.
+func (c *ClusterState) nodeNames(ctx context.Context, ids []string, nodeName func(ctx context.Context, id string) (string, error)) ([]string, error) {
+	var names []string
+	for _, id := range ids {
+		name, err := nodeName(ctx, id)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// waitForNodesReady waits for the given number of nodes matching the given
+// label selector to be ready.
+func (c *ClusterState) waitForNodesReady(ctx context.Context, selector string, num int) error {
+	o := func() error {
+		ready, err := c.countReadyNodes(ctx, selector)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		if ready < num {
+			return microerror.Maskf(waitError, "want %d ready nodes matching %#q found %d", num, selector, ready)
+		}
+
+		return nil
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	n := func(err error, delay time.Duration) {
+		c.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *ClusterState) countReadyNodes(ctx context.Context, selector string) (int, error) {
+	lo := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	l, err := c.k8sClient.K8sClient().CoreV1().Nodes().List(ctx, lo)
+	if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	var ready int
+	for _, n := range l.Items {
+		if isNodeReady(n) {
+			ready++
+		}
+	}
+
+	return ready, nil
+}
+
+func isNodeReady(n corev1.Node) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,176 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// partitionMaster isolates the master identified by the given ID from all
+// workers for the configured duration. The partition expires on its own, so
+// that single master clusters recover without API access. Once it expired the
+// partition is cleaned up. It then waits for all nodes to be ready again,
+// checks no pods of the test app or the stateful workload got lost or
+// duplicated and checks the cluster state. The recovery after healing the
+// partition is added to the given state.
+func (c *ClusterState) partitionMaster(ctx context.Context, state *State, id string) error {
+	nodes, err := c.findNodes(ctx, "")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	healed := false
+	defer func() {
+		if healed {
+			return
+		}
+
+		err := c.provider.HealPartition(ctx)
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "error", "message", "failed to heal network partition", "stack", fmt.Sprintf("%#v", err))
+		}
+	}()
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("partitioning master %#q from workers", id))
+
+		err = c.provider.PartitionMaster(ctx, id, c.networkPartition.Duration)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("partitioned master %#q from workers", id))
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting %s for network partition to expire", c.networkPartition.Duration))
+
+		select {
+		case <-time.After(c.networkPartition.Duration):
+		case <-ctx.Done():
+			return microerror.Mask(ctx.Err())
+		}
+	}
+
+	d := c.startDisruption(ctx, "healing partitioned master", id)
+	defer d.ready()
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cleaning up network partition")
+
+		healed = true
+		err = c.provider.HealPartition(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cleaned up network partition")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for %d nodes to be ready", len(nodes)))
+
+		err = c.waitForNodesReady(ctx, "", len(nodes))
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("%d nodes are ready", len(nodes)))
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for guest cluster")
+
+		err = c.legacyFramework.WaitForGuestReady(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "guest cluster ready")
+	}
+
+	err = c.recordDisruption(ctx, state, d.ready())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking no pods got lost or duplicated")
+
+		if state.testAppInstalled {
+			err = c.waitForPodCount(ctx, c.testApp.Namespace, c.testApp.PodLabelSelector, c.testApp.PodCount)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+		}
+		if state.statefulWorkload != nil {
+			err = c.waitForPodCount(ctx, statefulWorkloadNamespace, statefulWorkloadSelector, 1)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "no pods got lost or duplicated")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking cluster state")
+
+		err = c.checkClusterState(ctx, state)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cluster state is intact")
+	}
+
+	return nil
+}
+
+// waitForPodCount waits for exactly the given number of pods matching the
+// given label selector to exist, not counting terminating pods. Pods of
+// unreachable nodes which got replaced must be gone, so that no workload runs
+// twice once the nodes are reachable again.
+func (c *ClusterState) waitForPodCount(ctx context.Context, namespace, selector string, num int) error {
+	o := func() error {
+		lo := metav1.ListOptions{
+			LabelSelector: selector,
+		}
+		l, err := c.k8sClient.K8sClient().CoreV1().Pods(namespace).List(ctx, lo)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		var count int
+		for _, p := range l.Items {
+			if p.DeletionTimestamp == nil {
+				count++
+			}
+		}
+
+		if count < num {
+			return microerror.Maskf(podCountMismatchError, "%d pods matching %#q got lost, found %d, want %d", num-count, selector, count, num)
+		}
+		if count > num {
+			return microerror.Maskf(podCountMismatchError, "%d pods matching %#q got duplicated, found %d, want %d", count-num, selector, count, num)
+		}
+
+		return nil
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	n := func(err error, delay time.Duration) {
+		c.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package clusterstate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+var errPartitionFailed = errors.New("partition failed")
+
+func Test_ClusterState_partitionMaster(t *testing.T) {
+	testCases := []struct {
+		name string
+		// disrupt wraps the disruptions of the fake cluster.
+		disrupt       func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error
+		expectedCalls []string
+		errorMatcher  func(error) bool
+	}{
+		{
+			name: "case 0: partition is healed and cluster recovers",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return cluster.Disrupt
+			},
+			expectedCalls: []string{"Masters()", "PartitionMaster(m1)", "HealPartition()"},
+		},
+		{
+			name: "case 1: partition fails and is healed anyway",
+			disrupt: func(cluster *clusterstatetest.Cluster) func(ctx context.Context, method, id string) error {
+				return func(ctx context.Context, method, id string) error {
+					if method == "PartitionMaster" {
+						return errPartitionFailed
+					}
+					return cluster.Disrupt(ctx, method, id)
+				}
+			},
+			expectedCalls: []string{"Masters()", "PartitionMaster(m1)", "HealPartition()"},
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errPartitionFailed
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cluster := clusterstatetest.NewCluster(clusterstatetest.ClusterConfig{
+				Masters: []string{"m1"},
+				Workers: []string{"w1", "w2"},
+			})
+
+			p := providertest.New(providertest.Config{
+				Masters:  []string{"m1"},
+				Workers:  []string{"w1", "w2"},
+				Disrupt:  tc.disrupt(cluster),
+				NodeName: cluster.NodeName,
+			})
+
+			c, err := New(Config{
+				K8sClient:       cluster.Clients(),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        p,
+
+				NetworkPartition: NetworkPartitionConfig{Duration: 10 * time.Millisecond},
+				Scenario: &Scenario{
+					Name: "partition",
+					Steps: []Step{
+						InstallTestApp(),
+						PartitionMaster(),
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			c.chartInstaller = &chartInstallerFake{}
+
+			err = c.Test(context.Background())
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(p.Calls(), tc.expectedCalls) {
+				t.Fatalf("%s: calls == %#v, want %#v", tc.name, p.Calls(), tc.expectedCalls)
+			}
+		})
+	}
+}
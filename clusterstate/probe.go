@@ -0,0 +1,117 @@
+package clusterstate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	apiProbeInterval = 1 * time.Second
+	apiProbeTimeout  = 5 * time.Second
+)
+
+// apiProbe continuously probes the tenant cluster Kubernetes API in the
+// background and records the windows in which the API was unavailable.
+type apiProbe struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex   sync.Mutex
+	down    bool
+	windows []DowntimeWindow
+}
+
+func (c *ClusterState) startAPIProbe(ctx context.Context) *apiProbe {
+	ctx, cancel := context.WithCancel(ctx)
+
+	p := &apiProbe{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.done)
+
+		var unavailableSince time.Time
+		for {
+			now := time.Now()
+			err := c.probeAPI(ctx)
+			if ctx.Err() != nil {
+				// Requests cancelled by stopping the probe do not count as
+				// unavailability.
+			} else if err != nil && unavailableSince.IsZero() {
+				unavailableSince = now
+				p.setDown(true)
+			} else if err == nil && !unavailableSince.IsZero() {
+				p.observe(unavailableSince, now)
+				unavailableSince = time.Time{}
+			}
+
+			select {
+			case <-ctx.Done():
+				if !unavailableSince.IsZero() {
+					p.observe(unavailableSince, time.Now())
+				}
+				return
+			case <-time.After(apiProbeInterval):
+			}
+		}
+	}()
+
+	return p
+}
+
+// stop stops probing and returns the windows in which the API was
+// unavailable. It is safe to call stop multiple times.
+func (p *apiProbe) stop() []DowntimeWindow {
+	p.cancel()
+	<-p.done
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]DowntimeWindow(nil), p.windows...)
+}
+
+// observedDowntime returns true if the API is currently unavailable or was
+// unavailable since the probe started.
+func (p *apiProbe) observedDowntime() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.down || len(p.windows) > 0
+}
+
+func (p *apiProbe) observe(start, end time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.down = false
+	p.windows = append(p.windows, DowntimeWindow{Start: start, End: end})
+}
+
+func (p *apiProbe) setDown(down bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.down = down
+}
+
+func (c *ClusterState) probeAPI(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, apiProbeTimeout)
+	defer cancel()
+
+	_, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Get(ctx, metav1.NamespaceDefault, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// The API answered, so it is available.
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
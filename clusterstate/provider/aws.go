@@ -0,0 +1,359 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+)
+
+var _ Interface = &AWS{}
+
+const (
+	// awsTagCluster and awsTagRole are the tags the aws-operator puts on the
+	// EC2 instances of tenant cluster nodes.
+	awsTagCluster = "giantswarm.io/cluster"
+	awsTagRole    = "giantswarm.io/instance-role"
+
+	awsInstanceStateRunning = "running"
+
+	awsRoleMaster = "master"
+	awsRoleWorker = "worker"
+)
+
+// AWSClient is the subset of the EC2 and Auto Scaling APIs used by AWS.
+// SDKAWSClient wraps the AWS SDK. LocalAWSClient is used in tests.
+type AWSClient interface {
+	// DescribeInstances returns all instances carrying all of the given tags
+	// which are not terminated.
+	DescribeInstances(ctx context.Context, tags map[string]string) ([]AWSInstance, error)
+	// RebootInstance reboots the instance with the given ID.
+	RebootInstance(ctx context.Context, id string) error
+	// TerminateInstanceInAutoScalingGroup terminates the instance with the
+	// given ID without decrementing the desired capacity of its Auto Scaling
+	// group, so that the group launches a new instance.
+	TerminateInstanceInAutoScalingGroup(ctx context.Context, id string) error
+}
+
+// AWSInstance is an EC2 instance running a tenant cluster node.
+type AWSInstance struct {
+	ID string
+	// PrivateDNSName is the name of the tenant cluster node running on the
+	// instance.
+	PrivateDNSName string
+	// State is the EC2 instance state, e.g. "pending" or "running".
+	State string
+	Tags  map[string]string
+}
+
+type AWSConfig struct {
+	Client AWSClient
+	Logger micrologger.Logger
+	// TenantK8sClient is only required for draining workers and network
+	// partitions.
+	TenantK8sClient k8sclient.Interface
+
+	ClusterID string
+}
+
+// AWS disrupts the EC2 instances of tenant cluster nodes. Master and worker
+// IDs are EC2 instance IDs.
+type AWS struct {
+	client          AWSClient
+	logger          micrologger.Logger
+	tenantK8sClient k8sclient.Interface
+
+	clusterID string
+}
+
+func NewAWS(config AWSConfig) (*AWS, error) {
+	if config.Client == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Client must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	if config.ClusterID == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ClusterID must not be empty", config)
+	}
+
+	a := &AWS{
+		client:          config.Client,
+		logger:          config.Logger,
+		tenantK8sClient: config.TenantK8sClient,
+
+		clusterID: config.ClusterID,
+	}
+
+	return a, nil
+}
+
+func (a *AWS) Masters(ctx context.Context) ([]string, error) {
+	ids, err := a.instanceIDs(ctx, awsRoleMaster)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ids, nil
+}
+
+// MasterNodeName returns the private DNS name of its instance.
+func (a *AWS) MasterNodeName(ctx context.Context, id string) (string, error) {
+	instance, err := a.findInstance(ctx, awsRoleMaster, id)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return instance.PrivateDNSName, nil
+}
+
+func (a *AWS) RebootMaster(ctx context.Context, id string) error {
+	err := a.rebootInstance(ctx, awsRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// ReplaceMaster terminates the master instance and waits for the Auto Scaling
+// group to launch a new one. The new master boots from a fresh root volume
+// and registers a new node.
+func (a *AWS) ReplaceMaster(ctx context.Context, id string) error {
+	err := a.replaceInstance(ctx, awsRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *AWS) Workers(ctx context.Context) ([]string, error) {
+	ids, err := a.instanceIDs(ctx, awsRoleWorker)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ids, nil
+}
+
+// WorkerNodeName returns the private DNS name of its instance.
+func (a *AWS) WorkerNodeName(ctx context.Context, id string) (string, error) {
+	instance, err := a.findInstance(ctx, awsRoleWorker, id)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return instance.PrivateDNSName, nil
+}
+
+// DrainWorker drains the tenant cluster node of the given worker. Nodes on
+// AWS are named after the private DNS name of their instance.
+func (a *AWS) DrainWorker(ctx context.Context, id string) error {
+	if a.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for draining workers")
+	}
+
+	instance, err := a.findInstance(ctx, awsRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = drainNode(ctx, a.tenantK8sClient, a.logger, instance.PrivateDNSName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *AWS) RebootWorker(ctx context.Context, id string) error {
+	err := a.rebootInstance(ctx, awsRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// ReplaceWorker terminates the worker instance and waits for the Auto Scaling
+// group to launch a new one, the same way ReplaceMaster does for masters.
+func (a *AWS) ReplaceWorker(ctx context.Context, id string) error {
+	err := a.replaceInstance(ctx, awsRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// PartitionMaster isolates the node of the given master from all workers for
+// the given duration using a privileged iptables DaemonSet in the tenant
+// cluster.
+func (a *AWS) PartitionMaster(ctx context.Context, id string, duration time.Duration) error {
+	if a.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for partitioning masters")
+	}
+
+	instance, err := a.findInstance(ctx, awsRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = partitionNode(ctx, a.tenantK8sClient, a.logger, instance.PrivateDNSName, duration)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *AWS) HealPartition(ctx context.Context) error {
+	if a.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for healing partitions")
+	}
+
+	err := healPartition(ctx, a.tenantK8sClient, a.logger)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// BackupEtcd is not supported, see KVM.BackupEtcd.
+func (a *AWS) BackupEtcd(ctx context.Context) (string, error) {
+	return "", microerror.Maskf(notSupportedError, "backing up etcd of AWS tenant cluster %#q", a.clusterID)
+}
+
+// RestoreEtcd is not supported because restoring etcd backups is a manual
+// operation for AWS tenant clusters.
+func (a *AWS) RestoreEtcd(ctx context.Context, id string) error {
+	return microerror.Maskf(notSupportedError, "restoring etcd backup %#q of AWS tenant cluster %#q", id, a.clusterID)
+}
+
+func (a *AWS) findInstance(ctx context.Context, role, id string) (AWSInstance, error) {
+	instances, err := a.runningInstances(ctx, role)
+	if err != nil {
+		return AWSInstance{}, microerror.Mask(err)
+	}
+
+	for _, i := range instances {
+		if i.ID == id {
+			return i, nil
+		}
+	}
+
+	return AWSInstance{}, microerror.Maskf(notFoundError, "%s instance %#q", role, id)
+}
+
+// instanceIDs returns the sorted IDs of the running instances of the given
+// role.
+func (a *AWS) instanceIDs(ctx context.Context, role string) ([]string, error) {
+	instances, err := a.runningInstances(ctx, role)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var ids []string
+	for _, i := range instances {
+		ids = append(ids, i.ID)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (a *AWS) rebootInstance(ctx context.Context, role, id string) error {
+	_, err := a.findInstance(ctx, role, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = a.client.RebootInstance(ctx, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *AWS) replaceInstance(ctx context.Context, role, id string) error {
+	before, err := a.runningInstances(ctx, role)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	_, err = a.findInstance(ctx, role, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	{
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("terminating %s instance %#q", role, id))
+
+		err = a.client.TerminateInstanceInAutoScalingGroup(ctx, id)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("terminated %s instance %#q", role, id))
+	}
+
+	o := func() error {
+		after, err := a.runningInstances(ctx, role)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		for _, i := range after {
+			if i.ID == id {
+				return microerror.Maskf(waitError, "%s instance %#q is still running", role, id)
+			}
+		}
+		if len(after) < len(before) {
+			return microerror.Maskf(waitError, "want %d running %s instances found %d", len(before), role, len(after))
+		}
+
+		return nil
+	}
+
+	n := func(err error, t time.Duration) {
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for %s instance to be replaced: retrying in %s", role, t), "stack", fmt.Sprintf("%v", err))
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	err = backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *AWS) runningInstances(ctx context.Context, role string) ([]AWSInstance, error) {
+	tags := map[string]string{
+		awsTagCluster: a.clusterID,
+		awsTagRole:    role,
+	}
+
+	instances, err := a.client.DescribeInstances(ctx, tags)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var running []AWSInstance
+	for _, i := range instances {
+		if i.State == awsInstanceStateRunning {
+			running = append(running, i)
+		}
+	}
+
+	return running, nil
+}
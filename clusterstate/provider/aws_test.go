@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+func Test_AWS(t *testing.T) {
+	instance := func(id, cluster, role, state string) AWSInstance {
+		return AWSInstance{
+			ID:             id,
+			PrivateDNSName: id + ".internal",
+			State:          state,
+			Tags: map[string]string{
+				awsTagCluster: cluster,
+				awsTagRole:    role,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name            string
+		run             func(ctx context.Context, a *AWS) error
+		expectedCalls   []string
+		expectedMasters []string
+		errorMatcher    func(error) bool
+	}{
+		{
+			name: "case 0: list masters of the cluster",
+			run: func(ctx context.Context, a *AWS) error {
+				return nil
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"i-m1", "i-m2"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 1: reboot master",
+			run: func(ctx context.Context, a *AWS) error {
+				return a.RebootMaster(ctx, "i-m1")
+			},
+			expectedCalls:   []string{"RebootInstance(i-m1)"},
+			expectedMasters: []string{"i-m1", "i-m2"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 2: reboot worker as master",
+			run: func(ctx context.Context, a *AWS) error {
+				return a.RebootMaster(ctx, "i-w1")
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"i-m1", "i-m2"},
+			errorMatcher:    IsNotFound,
+		},
+		{
+			name: "case 3: reboot master of another cluster",
+			run: func(ctx context.Context, a *AWS) error {
+				return a.RebootMaster(ctx, "i-other")
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"i-m1", "i-m2"},
+			errorMatcher:    IsNotFound,
+		},
+		{
+			name: "case 4: replace master",
+			run: func(ctx context.Context, a *AWS) error {
+				return a.ReplaceMaster(ctx, "i-m1")
+			},
+			expectedCalls:   []string{"TerminateInstanceInAutoScalingGroup(i-m1)"},
+			expectedMasters: []string{"i-launched-1", "i-m2"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 5: drain worker without tenant client",
+			run: func(ctx context.Context, a *AWS) error {
+				return a.DrainWorker(ctx, "i-w1")
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"i-m1", "i-m2"},
+			errorMatcher:    IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			client := NewLocalAWSClient(LocalAWSClientConfig{
+				Instances: []AWSInstance{
+					instance("i-m2", "c1", awsRoleMaster, awsInstanceStateRunning),
+					instance("i-m1", "c1", awsRoleMaster, awsInstanceStateRunning),
+					instance("i-m0", "c1", awsRoleMaster, awsInstanceStateTerminated),
+					instance("i-w1", "c1", awsRoleWorker, awsInstanceStateRunning),
+					instance("i-other", "c2", awsRoleMaster, awsInstanceStateRunning),
+				},
+			})
+
+			a, err := NewAWS(AWSConfig{
+				Client: client,
+				Logger: microloggertest.New(),
+
+				ClusterID: "c1",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = tc.run(ctx, a)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(client.Calls(), tc.expectedCalls) {
+				t.Fatalf("%s: calls == %#v, want %#v", tc.name, client.Calls(), tc.expectedCalls)
+			}
+
+			masters, err := a.Masters(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			if !reflect.DeepEqual(masters, tc.expectedMasters) {
+				t.Fatalf("%s: masters == %#v, want %#v", tc.name, masters, tc.expectedMasters)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+)
+
+var _ AWSClient = &LocalAWSClient{}
+
+const (
+	awsInstanceStateTerminated = "terminated"
+)
+
+type LocalAWSClientConfig struct {
+	// Instances are the instances initially known to the client.
+	Instances []AWSInstance
+}
+
+// LocalAWSClient is an in-memory AWSClient stand-in recording all calls, so
+// that AWS can be tested without an AWS account. Terminated instances are
+// replaced immediately by a running instance with the same tags, like an Auto
+// Scaling group would eventually do.
+type LocalAWSClient struct {
+	mutex     sync.Mutex
+	calls     []string
+	instances []AWSInstance
+	launched  int
+}
+
+func NewLocalAWSClient(config LocalAWSClientConfig) *LocalAWSClient {
+	c := &LocalAWSClient{
+		instances: append([]AWSInstance(nil), config.Instances...),
+	}
+
+	return c
+}
+
+// Calls returns all calls made to the client in order, e.g.
+// "RebootInstance(i-1)".
+func (c *LocalAWSClient) Calls() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string(nil), c.calls...)
+}
+
+func (c *LocalAWSClient) DescribeInstances(ctx context.Context, tags map[string]string) ([]AWSInstance, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var instances []AWSInstance
+	for _, i := range c.instances {
+		if i.State == awsInstanceStateTerminated || !hasTags(i.Tags, tags) {
+			continue
+		}
+
+		instances = append(instances, i)
+	}
+
+	return instances, nil
+}
+
+func (c *LocalAWSClient) RebootInstance(ctx context.Context, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.calls = append(c.calls, fmt.Sprintf("RebootInstance(%s)", id))
+
+	_, err := c.find(id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *LocalAWSClient) TerminateInstanceInAutoScalingGroup(ctx context.Context, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.calls = append(c.calls, fmt.Sprintf("TerminateInstanceInAutoScalingGroup(%s)", id))
+
+	index, err := c.find(id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	c.instances[index].State = awsInstanceStateTerminated
+
+	c.launched++
+	c.instances = append(c.instances, AWSInstance{
+		ID:             fmt.Sprintf("i-launched-%d", c.launched),
+		PrivateDNSName: fmt.Sprintf("ip-10-1-0-%d.eu-central-1.compute.internal", c.launched),
+		State:          awsInstanceStateRunning,
+		Tags:           c.instances[index].Tags,
+	})
+
+	return nil
+}
+
+func (c *LocalAWSClient) find(id string) (int, error) {
+	for index, i := range c.instances {
+		if i.ID == id && i.State != awsInstanceStateTerminated {
+			return index, nil
+		}
+	}
+
+	return 0, microerror.Maskf(notFoundError, "instance %#q", id)
+}
+
+func hasTags(tags, want map[string]string) bool {
+	for k, v := range want {
+		if tags[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/giantswarm/microerror"
+)
+
+var _ AWSClient = &SDKAWSClient{}
+
+// awsInstanceStates are all EC2 instance states except "terminated", which
+// is filtered out by SDKAWSClient.DescribeInstances.
+var awsInstanceStates = []string{
+	"pending",
+	"running",
+	"shutting-down",
+	"stopping",
+	"stopped",
+}
+
+type SDKAWSClientConfig struct {
+	// AutoScaling is usually created with autoscaling.New.
+	AutoScaling autoscalingiface.AutoScalingAPI
+	// EC2 is usually created with ec2.New.
+	EC2 ec2iface.EC2API
+}
+
+// SDKAWSClient implements AWSClient using the EC2 and Auto Scaling clients
+// of the AWS SDK.
+type SDKAWSClient struct {
+	autoScaling autoscalingiface.AutoScalingAPI
+	ec2         ec2iface.EC2API
+}
+
+func NewSDKAWSClient(config SDKAWSClientConfig) (*SDKAWSClient, error) {
+	if config.AutoScaling == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.AutoScaling must not be empty", config)
+	}
+	if config.EC2 == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.EC2 must not be empty", config)
+	}
+
+	c := &SDKAWSClient{
+		autoScaling: config.AutoScaling,
+		ec2:         config.EC2,
+	}
+
+	return c, nil
+}
+
+func (c *SDKAWSClient) DescribeInstances(ctx context.Context, tags map[string]string) ([]AWSInstance, error) {
+	i := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice(awsInstanceStates),
+			},
+		},
+	}
+	for k, v := range tags {
+		i.Filters = append(i.Filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", k)),
+			Values: aws.StringSlice([]string{v}),
+		})
+	}
+
+	var instances []AWSInstance
+	fn := func(o *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range o.Reservations {
+			for _, ec2Instance := range r.Instances {
+				instance := AWSInstance{
+					ID:             aws.StringValue(ec2Instance.InstanceId),
+					PrivateDNSName: aws.StringValue(ec2Instance.PrivateDnsName),
+					Tags:           map[string]string{},
+				}
+				if ec2Instance.State != nil {
+					instance.State = aws.StringValue(ec2Instance.State.Name)
+				}
+				for _, t := range ec2Instance.Tags {
+					instance.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+				}
+
+				instances = append(instances, instance)
+			}
+		}
+
+		return true
+	}
+
+	err := c.ec2.DescribeInstancesPagesWithContext(ctx, i, fn)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return instances, nil
+}
+
+func (c *SDKAWSClient) RebootInstance(ctx context.Context, id string) error {
+	i := &ec2.RebootInstancesInput{
+		InstanceIds: aws.StringSlice([]string{id}),
+	}
+
+	_, err := c.ec2.RebootInstancesWithContext(ctx, i)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *SDKAWSClient) TerminateInstanceInAutoScalingGroup(ctx context.Context, id string) error {
+	i := &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+		InstanceId:                     aws.String(id),
+		ShouldDecrementDesiredCapacity: aws.Bool(false),
+	}
+
+	_, err := c.autoScaling.TerminateInstanceInAutoScalingGroupWithContext(ctx, i)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
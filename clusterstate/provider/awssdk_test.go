@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// ec2Fake serves the configured pages of instances and records the filters
+// and instance IDs it is called with.
+type ec2Fake struct {
+	ec2iface.EC2API
+
+	pages []*ec2.DescribeInstancesOutput
+
+	filters  map[string][]string
+	rebooted []string
+}
+
+func (e *ec2Fake) DescribeInstancesPagesWithContext(ctx aws.Context, i *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, opts ...request.Option) error {
+	e.filters = map[string][]string{}
+	for _, f := range i.Filters {
+		e.filters[aws.StringValue(f.Name)] = aws.StringValueSlice(f.Values)
+	}
+
+	for index, p := range e.pages {
+		if !fn(p, index == len(e.pages)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (e *ec2Fake) RebootInstancesWithContext(ctx aws.Context, i *ec2.RebootInstancesInput, opts ...request.Option) (*ec2.RebootInstancesOutput, error) {
+	e.rebooted = append(e.rebooted, aws.StringValueSlice(i.InstanceIds)...)
+
+	return &ec2.RebootInstancesOutput{}, nil
+}
+
+type autoScalingFake struct {
+	autoscalingiface.AutoScalingAPI
+
+	terminated []*autoscaling.TerminateInstanceInAutoScalingGroupInput
+}
+
+func (a *autoScalingFake) TerminateInstanceInAutoScalingGroupWithContext(ctx aws.Context, i *autoscaling.TerminateInstanceInAutoScalingGroupInput, opts ...request.Option) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+	a.terminated = append(a.terminated, i)
+
+	return &autoscaling.TerminateInstanceInAutoScalingGroupOutput{}, nil
+}
+
+func Test_SDKAWSClient_DescribeInstances(t *testing.T) {
+	ec2Instance := func(id, state string) *ec2.Instance {
+		return &ec2.Instance{
+			InstanceId:     aws.String(id),
+			PrivateDnsName: aws.String(id + ".internal"),
+			State:          &ec2.InstanceState{Name: aws.String(state)},
+			Tags: []*ec2.Tag{
+				{Key: aws.String(awsTagCluster), Value: aws.String("c1")},
+			},
+		}
+	}
+	instance := func(id, state string) AWSInstance {
+		return AWSInstance{
+			ID:             id,
+			PrivateDNSName: id + ".internal",
+			State:          state,
+			Tags:           map[string]string{awsTagCluster: "c1"},
+		}
+	}
+
+	testCases := []struct {
+		name              string
+		pages             []*ec2.DescribeInstancesOutput
+		expectedInstances []AWSInstance
+	}{
+		{
+			name:              "case 0: no instances",
+			pages:             []*ec2.DescribeInstancesOutput{{}},
+			expectedInstances: nil,
+		},
+		{
+			name: "case 1: instances of all reservations and pages",
+			pages: []*ec2.DescribeInstancesOutput{
+				{
+					Reservations: []*ec2.Reservation{
+						{Instances: []*ec2.Instance{ec2Instance("i-1", "running")}},
+						{Instances: []*ec2.Instance{ec2Instance("i-2", "pending")}},
+					},
+				},
+				{
+					Reservations: []*ec2.Reservation{
+						{Instances: []*ec2.Instance{ec2Instance("i-3", "stopped")}},
+					},
+				},
+			},
+			expectedInstances: []AWSInstance{
+				instance("i-1", "running"),
+				instance("i-2", "pending"),
+				instance("i-3", "stopped"),
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			e := &ec2Fake{pages: tc.pages}
+
+			c, err := NewSDKAWSClient(SDKAWSClientConfig{
+				AutoScaling: &autoScalingFake{},
+				EC2:         e,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			instances, err := c.DescribeInstances(context.Background(), map[string]string{awsTagCluster: "c1", awsTagRole: awsRoleMaster})
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+			if !reflect.DeepEqual(instances, tc.expectedInstances) {
+				t.Fatalf("%s: instances == %#v, want %#v", tc.name, instances, tc.expectedInstances)
+			}
+
+			expectedFilters := map[string][]string{
+				"instance-state-name":  awsInstanceStates,
+				"tag:" + awsTagCluster: {"c1"},
+				"tag:" + awsTagRole:    {awsRoleMaster},
+			}
+			if !reflect.DeepEqual(e.filters, expectedFilters) {
+				t.Fatalf("%s: filters == %#v, want %#v", tc.name, e.filters, expectedFilters)
+			}
+		})
+	}
+}
+
+func Test_SDKAWSClient_Disrupt(t *testing.T) {
+	testCases := []struct {
+		name               string
+		run                func(ctx context.Context, c *SDKAWSClient) error
+		expectedRebooted   []string
+		expectedTerminated []*autoscaling.TerminateInstanceInAutoScalingGroupInput
+	}{
+		{
+			name: "case 0: reboot instance",
+			run: func(ctx context.Context, c *SDKAWSClient) error {
+				return c.RebootInstance(ctx, "i-1")
+			},
+			expectedRebooted: []string{"i-1"},
+		},
+		{
+			name: "case 1: terminate instance without decrementing the desired capacity",
+			run: func(ctx context.Context, c *SDKAWSClient) error {
+				return c.TerminateInstanceInAutoScalingGroup(ctx, "i-1")
+			},
+			expectedTerminated: []*autoscaling.TerminateInstanceInAutoScalingGroupInput{
+				{
+					InstanceId:                     aws.String("i-1"),
+					ShouldDecrementDesiredCapacity: aws.Bool(false),
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			e := &ec2Fake{}
+			a := &autoScalingFake{}
+
+			c, err := NewSDKAWSClient(SDKAWSClientConfig{
+				AutoScaling: a,
+				EC2:         e,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = tc.run(context.Background(), c)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %#v", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(e.rebooted, tc.expectedRebooted) {
+				t.Fatalf("%s: rebooted == %#v, want %#v", tc.name, e.rebooted, tc.expectedRebooted)
+			}
+			if !reflect.DeepEqual(a.terminated, tc.expectedTerminated) {
+				t.Fatalf("%s: terminated == %#v, want %#v", tc.name, a.terminated, tc.expectedTerminated)
+			}
+		})
+	}
+}
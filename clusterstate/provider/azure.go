@@ -0,0 +1,403 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+)
+
+var _ Interface = &Azure{}
+
+const (
+	azureProvisioningStateSucceeded = "Succeeded"
+
+	azureRoleMaster = "master"
+	azureRoleWorker = "worker"
+)
+
+// AzureClient is the subset of the virtual machine scale set API used by
+// Azure. SDKAzureClient wraps the Azure SDK. LocalAzureClient is used in
+// tests.
+type AzureClient interface {
+	// ListInstances returns all instances of the given scale set.
+	ListInstances(ctx context.Context, resourceGroup, scaleSet string) ([]AzureInstance, error)
+	// RestartInstance restarts the instance with the given instance ID.
+	RestartInstance(ctx context.Context, resourceGroup, scaleSet, instanceID string) error
+	// DeleteInstance deletes the instance with the given instance ID, which
+	// decrements the capacity of the scale set.
+	DeleteInstance(ctx context.Context, resourceGroup, scaleSet, instanceID string) error
+	// SetCapacity sets the number of instances of the scale set. New
+	// instances get new instance IDs and computer names.
+	SetCapacity(ctx context.Context, resourceGroup, scaleSet string, capacity int) error
+}
+
+// AzureInstance is a virtual machine scale set instance running a tenant
+// cluster node.
+type AzureInstance struct {
+	InstanceID string
+	// ComputerName is the name of the tenant cluster node running on the
+	// instance.
+	ComputerName string
+	// ProvisioningState is the provisioning state of the instance, e.g.
+	// "Creating" or "Succeeded".
+	ProvisioningState string
+}
+
+type AzureConfig struct {
+	Client AzureClient
+	Logger micrologger.Logger
+	// TenantK8sClient is only required for draining workers and network
+	// partitions.
+	TenantK8sClient k8sclient.Interface
+
+	ClusterID string
+	// MasterScaleSet is the name of the scale set of the masters. Defaults to
+	// <cluster-id>-master-<cluster-id>, as created by the azure-operator.
+	MasterScaleSet string
+	// ResourceGroup is the resource group of the tenant cluster. Defaults to
+	// the cluster ID.
+	ResourceGroup string
+	// WorkerScaleSet is the name of the scale set of the workers. Defaults to
+	// <cluster-id>-worker-<cluster-id>, as created by the azure-operator.
+	WorkerScaleSet string
+}
+
+// Azure disrupts the virtual machine scale set instances of tenant cluster
+// nodes. Master and worker IDs are instance IDs within their scale set.
+type Azure struct {
+	client          AzureClient
+	logger          micrologger.Logger
+	tenantK8sClient k8sclient.Interface
+
+	clusterID     string
+	resourceGroup string
+	scaleSets     map[string]string
+}
+
+func NewAzure(config AzureConfig) (*Azure, error) {
+	if config.Client == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Client must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	if config.ClusterID == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ClusterID must not be empty", config)
+	}
+	if config.MasterScaleSet == "" {
+		config.MasterScaleSet = fmt.Sprintf("%s-%s-%s", config.ClusterID, azureRoleMaster, config.ClusterID)
+	}
+	if config.ResourceGroup == "" {
+		config.ResourceGroup = config.ClusterID
+	}
+	if config.WorkerScaleSet == "" {
+		config.WorkerScaleSet = fmt.Sprintf("%s-%s-%s", config.ClusterID, azureRoleWorker, config.ClusterID)
+	}
+
+	a := &Azure{
+		client:          config.Client,
+		logger:          config.Logger,
+		tenantK8sClient: config.TenantK8sClient,
+
+		clusterID:     config.ClusterID,
+		resourceGroup: config.ResourceGroup,
+		scaleSets: map[string]string{
+			azureRoleMaster: config.MasterScaleSet,
+			azureRoleWorker: config.WorkerScaleSet,
+		},
+	}
+
+	return a, nil
+}
+
+func (a *Azure) Masters(ctx context.Context) ([]string, error) {
+	ids, err := a.instanceIDs(ctx, azureRoleMaster)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ids, nil
+}
+
+// MasterNodeName returns the computer name of its instance.
+func (a *Azure) MasterNodeName(ctx context.Context, id string) (string, error) {
+	instance, err := a.findInstance(ctx, azureRoleMaster, id)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return instance.ComputerName, nil
+}
+
+func (a *Azure) RebootMaster(ctx context.Context, id string) error {
+	err := a.restartInstance(ctx, azureRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// ReplaceMaster deletes the master instance and restores the capacity of the
+// scale set, which creates a new instance with a new computer name and fresh
+// disks.
+func (a *Azure) ReplaceMaster(ctx context.Context, id string) error {
+	err := a.replaceInstance(ctx, azureRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *Azure) Workers(ctx context.Context) ([]string, error) {
+	ids, err := a.instanceIDs(ctx, azureRoleWorker)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ids, nil
+}
+
+// WorkerNodeName returns the computer name of its instance.
+func (a *Azure) WorkerNodeName(ctx context.Context, id string) (string, error) {
+	instance, err := a.findInstance(ctx, azureRoleWorker, id)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return instance.ComputerName, nil
+}
+
+// DrainWorker drains the tenant cluster node of the given worker. Nodes on
+// Azure are named after the computer name of their instance.
+func (a *Azure) DrainWorker(ctx context.Context, id string) error {
+	if a.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for draining workers")
+	}
+
+	instance, err := a.findInstance(ctx, azureRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = drainNode(ctx, a.tenantK8sClient, a.logger, instance.ComputerName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *Azure) RebootWorker(ctx context.Context, id string) error {
+	err := a.restartInstance(ctx, azureRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// ReplaceWorker deletes the worker instance and restores the capacity of the
+// scale set, the same way ReplaceMaster does for masters.
+func (a *Azure) ReplaceWorker(ctx context.Context, id string) error {
+	err := a.replaceInstance(ctx, azureRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// PartitionMaster isolates the node of the given master from all workers for
+// the given duration using a privileged iptables DaemonSet in the tenant
+// cluster.
+func (a *Azure) PartitionMaster(ctx context.Context, id string, duration time.Duration) error {
+	if a.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for partitioning masters")
+	}
+
+	instance, err := a.findInstance(ctx, azureRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = partitionNode(ctx, a.tenantK8sClient, a.logger, instance.ComputerName, duration)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *Azure) HealPartition(ctx context.Context) error {
+	if a.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for healing partitions")
+	}
+
+	err := healPartition(ctx, a.tenantK8sClient, a.logger)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// BackupEtcd is not supported, see KVM.BackupEtcd.
+func (a *Azure) BackupEtcd(ctx context.Context) (string, error) {
+	return "", microerror.Maskf(notSupportedError, "backing up etcd of Azure tenant cluster %#q", a.clusterID)
+}
+
+// RestoreEtcd is not supported because restoring etcd backups is a manual
+// operation for Azure tenant clusters.
+func (a *Azure) RestoreEtcd(ctx context.Context, id string) error {
+	return microerror.Maskf(notSupportedError, "restoring etcd backup %#q of Azure tenant cluster %#q", id, a.clusterID)
+}
+
+func (a *Azure) findInstance(ctx context.Context, role, id string) (AzureInstance, error) {
+	instances, err := a.provisionedInstances(ctx, role)
+	if err != nil {
+		return AzureInstance{}, microerror.Mask(err)
+	}
+
+	for _, i := range instances {
+		if i.InstanceID == id {
+			return i, nil
+		}
+	}
+
+	return AzureInstance{}, microerror.Maskf(notFoundError, "%s instance %#q in scale set %#q", role, id, a.scaleSets[role])
+}
+
+// instanceIDs returns the sorted instance IDs of the provisioned instances of
+// the given role.
+func (a *Azure) instanceIDs(ctx context.Context, role string) ([]string, error) {
+	instances, err := a.provisionedInstances(ctx, role)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var ids []string
+	for _, i := range instances {
+		ids = append(ids, i.InstanceID)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (a *Azure) restartInstance(ctx context.Context, role, id string) error {
+	_, err := a.findInstance(ctx, role, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = a.client.RestartInstance(ctx, a.resourceGroup, a.scaleSets[role], id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *Azure) replaceInstance(ctx context.Context, role, id string) error {
+	scaleSet := a.scaleSets[role]
+
+	// The capacity of the scale set includes instances which are not
+	// provisioned yet, while the replacement is only complete once it is
+	// provisioned.
+	var capacity int
+	{
+		instances, err := a.client.ListInstances(ctx, a.resourceGroup, scaleSet)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		capacity = len(instances)
+	}
+
+	before, err := a.provisionedInstances(ctx, role)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	_, err = a.findInstance(ctx, role, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	{
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting %s instance %#q of scale set %#q", role, id, scaleSet))
+
+		err = a.client.DeleteInstance(ctx, a.resourceGroup, scaleSet, id)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleted %s instance %#q of scale set %#q", role, id, scaleSet))
+	}
+
+	{
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("restoring capacity %d of scale set %#q", capacity, scaleSet))
+
+		err = a.client.SetCapacity(ctx, a.resourceGroup, scaleSet, capacity)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("restored capacity %d of scale set %#q", capacity, scaleSet))
+	}
+
+	o := func() error {
+		after, err := a.provisionedInstances(ctx, role)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		for _, i := range after {
+			if i.InstanceID == id {
+				return microerror.Maskf(waitError, "%s instance %#q still exists", role, id)
+			}
+		}
+		if len(after) < len(before) {
+			return microerror.Maskf(waitError, "want %d provisioned %s instances found %d", len(before), role, len(after))
+		}
+
+		return nil
+	}
+
+	n := func(err error, t time.Duration) {
+		a.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for %s instance to be replaced: retrying in %s", role, t), "stack", fmt.Sprintf("%v", err))
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	err = backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *Azure) provisionedInstances(ctx context.Context, role string) ([]AzureInstance, error) {
+	instances, err := a.client.ListInstances(ctx, a.resourceGroup, a.scaleSets[role])
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var provisioned []AzureInstance
+	for _, i := range instances {
+		if i.ProvisioningState == azureProvisioningStateSucceeded {
+			provisioned = append(provisioned, i)
+		}
+	}
+
+	return provisioned, nil
+}
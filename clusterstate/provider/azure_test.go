@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+func Test_Azure(t *testing.T) {
+	instance := func(id, computerName, state string) AzureInstance {
+		return AzureInstance{
+			InstanceID:        id,
+			ComputerName:      computerName,
+			ProvisioningState: state,
+		}
+	}
+
+	testCases := []struct {
+		name            string
+		run             func(ctx context.Context, a *Azure) error
+		expectedCalls   []string
+		expectedMasters []string
+		errorMatcher    func(error) bool
+	}{
+		{
+			name: "case 0: list provisioned masters",
+			run: func(ctx context.Context, a *Azure) error {
+				return nil
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"0", "1"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 1: reboot master",
+			run: func(ctx context.Context, a *Azure) error {
+				return a.RebootMaster(ctx, "1")
+			},
+			expectedCalls:   []string{"RestartInstance(c1, c1-master-c1, 1)"},
+			expectedMasters: []string{"0", "1"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 2: reboot master which is not provisioned",
+			run: func(ctx context.Context, a *Azure) error {
+				return a.RebootMaster(ctx, "2")
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"0", "1"},
+			errorMatcher:    IsNotFound,
+		},
+		{
+			name: "case 3: replace master",
+			run: func(ctx context.Context, a *Azure) error {
+				return a.ReplaceMaster(ctx, "0")
+			},
+			expectedCalls: []string{
+				"DeleteInstance(c1, c1-master-c1, 0)",
+				"SetCapacity(c1, c1-master-c1, 3)",
+			},
+			expectedMasters: []string{"1", "3"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 4: reboot worker",
+			run: func(ctx context.Context, a *Azure) error {
+				return a.RebootWorker(ctx, "5")
+			},
+			expectedCalls:   []string{"RestartInstance(c1, c1-worker-c1, 5)"},
+			expectedMasters: []string{"0", "1"},
+			errorMatcher:    nil,
+		},
+		{
+			name: "case 5: drain worker without tenant client",
+			run: func(ctx context.Context, a *Azure) error {
+				return a.DrainWorker(ctx, "5")
+			},
+			expectedCalls:   nil,
+			expectedMasters: []string{"0", "1"},
+			errorMatcher:    IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.Background()
+
+			client := NewLocalAzureClient(LocalAzureClientConfig{
+				ScaleSets: map[string][]AzureInstance{
+					"c1-master-c1": {
+						instance("1", "c1-master-c1000001", azureProvisioningStateSucceeded),
+						instance("0", "c1-master-c1000000", azureProvisioningStateSucceeded),
+						instance("2", "c1-master-c1000002", "Creating"),
+					},
+					"c1-worker-c1": {
+						instance("5", "c1-worker-c1000005", azureProvisioningStateSucceeded),
+					},
+				},
+			})
+
+			a, err := NewAzure(AzureConfig{
+				Client: client,
+				Logger: microloggertest.New(),
+
+				ClusterID: "c1",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = tc.run(ctx, a)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(client.Calls(), tc.expectedCalls) {
+				t.Fatalf("%s: calls == %#v, want %#v", tc.name, client.Calls(), tc.expectedCalls)
+			}
+
+			masters, err := a.Masters(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			if !reflect.DeepEqual(masters, tc.expectedMasters) {
+				t.Fatalf("%s: masters == %#v, want %#v", tc.name, masters, tc.expectedMasters)
+			}
+		})
+	}
+}
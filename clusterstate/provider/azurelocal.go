@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+)
+
+var _ AzureClient = &LocalAzureClient{}
+
+type LocalAzureClientConfig struct {
+	// ScaleSets are the instances initially known to the client indexed by
+	// scale set name. Instance IDs must be numeric, like on Azure.
+	ScaleSets map[string][]AzureInstance
+}
+
+// LocalAzureClient is an in-memory AzureClient stand-in recording all calls,
+// so that Azure can be tested without an Azure subscription. New instances
+// get the next free instance ID and are provisioned immediately.
+type LocalAzureClient struct {
+	mutex     sync.Mutex
+	calls     []string
+	scaleSets map[string][]AzureInstance
+}
+
+func NewLocalAzureClient(config LocalAzureClientConfig) *LocalAzureClient {
+	c := &LocalAzureClient{
+		scaleSets: map[string][]AzureInstance{},
+	}
+
+	for name, instances := range config.ScaleSets {
+		c.scaleSets[name] = append([]AzureInstance(nil), instances...)
+	}
+
+	return c
+}
+
+// Calls returns all calls made to the client in order, e.g.
+// "RestartInstance(rg, vmss, 0)".
+func (c *LocalAzureClient) Calls() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string(nil), c.calls...)
+}
+
+func (c *LocalAzureClient) ListInstances(ctx context.Context, resourceGroup, scaleSet string) ([]AzureInstance, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	instances, ok := c.scaleSets[scaleSet]
+	if !ok {
+		return nil, microerror.Maskf(notFoundError, "scale set %#q", scaleSet)
+	}
+
+	return append([]AzureInstance(nil), instances...), nil
+}
+
+func (c *LocalAzureClient) RestartInstance(ctx context.Context, resourceGroup, scaleSet, instanceID string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.calls = append(c.calls, fmt.Sprintf("RestartInstance(%s, %s, %s)", resourceGroup, scaleSet, instanceID))
+
+	_, err := c.find(scaleSet, instanceID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *LocalAzureClient) DeleteInstance(ctx context.Context, resourceGroup, scaleSet, instanceID string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.calls = append(c.calls, fmt.Sprintf("DeleteInstance(%s, %s, %s)", resourceGroup, scaleSet, instanceID))
+
+	index, err := c.find(scaleSet, instanceID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	instances := c.scaleSets[scaleSet]
+	c.scaleSets[scaleSet] = append(instances[:index:index], instances[index+1:]...)
+
+	return nil
+}
+
+func (c *LocalAzureClient) SetCapacity(ctx context.Context, resourceGroup, scaleSet string, capacity int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.calls = append(c.calls, fmt.Sprintf("SetCapacity(%s, %s, %d)", resourceGroup, scaleSet, capacity))
+
+	instances, ok := c.scaleSets[scaleSet]
+	if !ok {
+		return microerror.Maskf(notFoundError, "scale set %#q", scaleSet)
+	}
+
+	var next int64
+	for _, i := range instances {
+		id, err := strconv.ParseInt(i.InstanceID, 10, 64)
+		if err != nil {
+			return microerror.Maskf(invalidConfigError, "instance ID %#q of scale set %#q is not numeric", i.InstanceID, scaleSet)
+		}
+		if id >= next {
+			next = id + 1
+		}
+	}
+
+	for len(instances) < capacity {
+		instances = append(instances, AzureInstance{
+			InstanceID: strconv.FormatInt(next, 10),
+			// Azure names instances after their scale set and their base 36
+			// encoded instance ID.
+			ComputerName:      fmt.Sprintf("%s%06s", scaleSet, strconv.FormatInt(next, 36)),
+			ProvisioningState: azureProvisioningStateSucceeded,
+		})
+		next++
+	}
+	if len(instances) > capacity {
+		instances = instances[:capacity]
+	}
+
+	c.scaleSets[scaleSet] = instances
+
+	return nil
+}
+
+func (c *LocalAzureClient) find(scaleSet, instanceID string) (int, error) {
+	for index, i := range c.scaleSets[scaleSet] {
+		if i.InstanceID == instanceID {
+			return index, nil
+		}
+	}
+
+	return 0, microerror.Maskf(notFoundError, "instance %#q of scale set %#q", instanceID, scaleSet)
+}
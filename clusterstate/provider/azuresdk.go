@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-12-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/giantswarm/microerror"
+)
+
+var _ AzureClient = &SDKAzureClient{}
+
+type SDKAzureClientConfig struct {
+	// Authorizer is usually created with auth.NewAuthorizerFromEnvironment.
+	Authorizer autorest.Authorizer
+
+	SubscriptionID string
+}
+
+// SDKAzureClient implements AzureClient using the virtual machine scale set
+// clients of the Azure SDK. All operations wait for Azure to complete them.
+type SDKAzureClient struct {
+	scaleSetsClient   compute.VirtualMachineScaleSetsClient
+	scaleSetVMsClient compute.VirtualMachineScaleSetVMsClient
+}
+
+func NewSDKAzureClient(config SDKAzureClientConfig) (*SDKAzureClient, error) {
+	if config.Authorizer == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Authorizer must not be empty", config)
+	}
+
+	if config.SubscriptionID == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.SubscriptionID must not be empty", config)
+	}
+
+	scaleSetsClient := compute.NewVirtualMachineScaleSetsClient(config.SubscriptionID)
+	scaleSetsClient.Authorizer = config.Authorizer
+
+	scaleSetVMsClient := compute.NewVirtualMachineScaleSetVMsClient(config.SubscriptionID)
+	scaleSetVMsClient.Authorizer = config.Authorizer
+
+	c := &SDKAzureClient{
+		scaleSetsClient:   scaleSetsClient,
+		scaleSetVMsClient: scaleSetVMsClient,
+	}
+
+	return c, nil
+}
+
+func (c *SDKAzureClient) ListInstances(ctx context.Context, resourceGroup, scaleSet string) ([]AzureInstance, error) {
+	iterator, err := c.scaleSetVMsClient.ListComplete(ctx, resourceGroup, scaleSet, "", "", "")
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var instances []AzureInstance
+	for iterator.NotDone() {
+		vm := iterator.Value()
+
+		instance := AzureInstance{
+			InstanceID: to.String(vm.InstanceID),
+		}
+		if vm.VirtualMachineScaleSetVMProperties != nil {
+			instance.ProvisioningState = to.String(vm.ProvisioningState)
+
+			if vm.OsProfile != nil {
+				instance.ComputerName = to.String(vm.OsProfile.ComputerName)
+			}
+		}
+
+		instances = append(instances, instance)
+
+		err = iterator.NextWithContext(ctx)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	return instances, nil
+}
+
+func (c *SDKAzureClient) RestartInstance(ctx context.Context, resourceGroup, scaleSet, instanceID string) error {
+	future, err := c.scaleSetVMsClient.Restart(ctx, resourceGroup, scaleSet, instanceID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, c.scaleSetVMsClient.Client)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *SDKAzureClient) DeleteInstance(ctx context.Context, resourceGroup, scaleSet, instanceID string) error {
+	future, err := c.scaleSetVMsClient.Delete(ctx, resourceGroup, scaleSet, instanceID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, c.scaleSetVMsClient.Client)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// SetCapacity updates the capacity of the scale set SKU. The SKU name and
+// tier are kept as they are.
+func (c *SDKAzureClient) SetCapacity(ctx context.Context, resourceGroup, scaleSet string, capacity int) error {
+	vmss, err := c.scaleSetsClient.Get(ctx, resourceGroup, scaleSet)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if vmss.Sku == nil {
+		return microerror.Maskf(notFoundError, "SKU of scale set %#q", scaleSet)
+	}
+
+	update := compute.VirtualMachineScaleSetUpdate{
+		Sku: &compute.Sku{
+			Name:     vmss.Sku.Name,
+			Tier:     vmss.Sku.Tier,
+			Capacity: to.Int64Ptr(int64(capacity)),
+		},
+	}
+
+	future, err := c.scaleSetsClient.Update(ctx, resourceGroup, scaleSet, update)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = future.WaitForCompletionRef(ctx, c.scaleSetsClient.Client)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// drainNode cordons the given tenant cluster node and evicts all pods running
+// on it, except for daemonset and static pods. It waits for all evicted pods
+// to be gone.
+func drainNode(ctx context.Context, k8sClient k8sclient.Interface, logger micrologger.Logger, nodeName string) error {
+	{
+		logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("cordoning node %#q", nodeName))
+
+		patch := []byte(`{"spec":{"unschedulable":true}}`)
+		_, err := k8sClient.K8sClient().CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("cordoned node %#q", nodeName))
+	}
+
+	var pods []corev1.Pod
+	{
+		lo := metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		}
+		l, err := k8sClient.K8sClient().CoreV1().Pods(metav1.NamespaceAll).List(ctx, lo)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		for _, p := range l.Items {
+			if isDaemonSetPod(p) || isStaticPod(p) {
+				continue
+			}
+			if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			pods = append(pods, p)
+		}
+	}
+
+	logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("evicting %d pods from node %#q", len(pods), nodeName))
+
+	for _, p := range pods {
+		p := p
+
+		o := func() error {
+			eviction := &policyv1beta1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      p.Name,
+					Namespace: p.Namespace,
+				},
+			}
+
+			err := k8sClient.K8sClient().PolicyV1beta1().Evictions(p.Namespace).Evict(ctx, eviction)
+			if apierrors.IsNotFound(err) {
+				return nil
+			} else if err != nil {
+				// Evictions are rejected with 429 as long as they would violate a
+				// pod disruption budget, so we retry.
+				return microerror.Mask(err)
+			}
+
+			return nil
+		}
+
+		b := backoff.NewConstant(backoff.ShortMaxWait, backoff.ShortMaxInterval)
+		n := backoff.NewNotifier(logger, ctx)
+
+		err := backoff.RetryNotify(o, b, n)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		o := func() error {
+			for _, p := range pods {
+				current, err := k8sClient.K8sClient().CoreV1().Pods(p.Namespace).Get(ctx, p.Name, metav1.GetOptions{})
+				if apierrors.IsNotFound(err) {
+					continue
+				} else if err != nil {
+					return microerror.Mask(err)
+				}
+				if current.UID == p.UID {
+					return microerror.Maskf(waitError, "pod %#q in namespace %#q still exists", p.Name, p.Namespace)
+				}
+			}
+
+			return nil
+		}
+
+		b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+		n := func(err error, t time.Duration) {
+			logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for evicted pods to be gone: retrying in %s", t), "stack", fmt.Sprintf("%v", err))
+		}
+
+		err := backoff.RetryNotify(o, b, n)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("evicted %d pods from node %#q", len(pods), nodeName))
+
+	return nil
+}
+
+func isDaemonSetPod(p corev1.Pod) bool {
+	for _, o := range p.OwnerReferences {
+		if o.Kind == "DaemonSet" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isStaticPod(p corev1.Pod) bool {
+	_, ok := p.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
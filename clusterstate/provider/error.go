@@ -28,3 +28,21 @@ var tooManyResultsError = &microerror.Error{
 func IsTooManyResults(err error) bool {
 	return microerror.Cause(err) == tooManyResultsError
 }
+
+var waitError = &microerror.Error{
+	Kind: "waitError",
+}
+
+// IsWait asserts waitError.
+func IsWait(err error) bool {
+	return microerror.Cause(err) == waitError
+}
+
+var notSupportedError = &microerror.Error{
+	Kind: "notSupportedError",
+}
+
+// IsNotSupported asserts notSupportedError.
+func IsNotSupported(err error) bool {
+	return microerror.Cause(err) == notSupportedError
+}
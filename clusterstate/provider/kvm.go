@@ -2,23 +2,42 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"time"
 
+	"github.com/giantswarm/backoff"
 	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+var _ Interface = &KVM{}
+
+const (
+	kvmRoleMaster = "master"
+	kvmRoleWorker = "worker"
 )
 
 type KVMConfig struct {
 	K8sClient k8sclient.Interface
 	Logger    micrologger.Logger
+	// TenantK8sClient is only required for draining workers and network
+	// partitions.
+	TenantK8sClient k8sclient.Interface
 
 	ClusterID string
 }
 
 type KVM struct {
-	k8sClient k8sclient.Interface
-	logger    micrologger.Logger
+	k8sClient       k8sclient.Interface
+	logger          micrologger.Logger
+	tenantK8sClient k8sclient.Interface
 
 	clusterID string
 }
@@ -36,8 +55,9 @@ func NewKVM(config KVMConfig) (*KVM, error) {
 	}
 
 	k := &KVM{
-		k8sClient: config.K8sClient,
-		logger:    config.Logger,
+		k8sClient:       config.K8sClient,
+		logger:          config.Logger,
+		tenantK8sClient: config.TenantK8sClient,
 
 		clusterID: config.ClusterID,
 	}
@@ -45,8 +65,28 @@ func NewKVM(config KVMConfig) (*KVM, error) {
 	return k, nil
 }
 
-func (k *KVM) RebootMaster(ctx context.Context) error {
-	err := k.deleteMasterPod(ctx)
+func (k *KVM) Masters(ctx context.Context) ([]string, error) {
+	ids, err := k.nodeIDs(ctx, kvmRoleMaster)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ids, nil
+}
+
+// MasterNodeName returns the name of the master pod, which is the name of
+// its tenant cluster node.
+func (k *KVM) MasterNodeName(ctx context.Context, id string) (string, error) {
+	masterPod, err := k.findNodePod(ctx, kvmRoleMaster, id)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return masterPod.Name, nil
+}
+
+func (k *KVM) RebootMaster(ctx context.Context, id string) error {
+	err := k.rebootNode(ctx, kvmRoleMaster, id)
 	if err != nil {
 		return microerror.Mask(err)
 	}
@@ -54,8 +94,13 @@ func (k *KVM) RebootMaster(ctx context.Context) error {
 	return nil
 }
 
-func (k *KVM) ReplaceMaster(ctx context.Context) error {
-	err := k.deleteMasterPod(ctx)
+// ReplaceMaster replaces the master by changing its ID in the KVMConfig CR.
+// The kvm-operator then deletes the master deployment of the old ID and
+// creates a new one, so the new master boots with fresh storage and a new
+// node identity. The persistent volume claims of the old master are deleted
+// once the old master pod is gone.
+func (k *KVM) ReplaceMaster(ctx context.Context, id string) error {
+	err := k.replaceNode(ctx, kvmRoleMaster, id)
 	if err != nil {
 		return microerror.Mask(err)
 	}
@@ -63,26 +108,274 @@ func (k *KVM) ReplaceMaster(ctx context.Context) error {
 	return nil
 }
 
-func (k *KVM) deleteMasterPod(ctx context.Context) error {
-	namespace := k.clusterID
-	listOptions := metav1.ListOptions{
-		LabelSelector: "app=master",
+func (k *KVM) Workers(ctx context.Context) ([]string, error) {
+	ids, err := k.nodeIDs(ctx, kvmRoleWorker)
+	if err != nil {
+		return nil, microerror.Mask(err)
 	}
 
-	pods, err := k.k8sClient.K8sClient().CoreV1().Pods(namespace).List(ctx, listOptions)
+	return ids, nil
+}
+
+// WorkerNodeName returns the name of the worker pod, which is the name of
+// its tenant cluster node.
+func (k *KVM) WorkerNodeName(ctx context.Context, id string) (string, error) {
+	workerPod, err := k.findNodePod(ctx, kvmRoleWorker, id)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return workerPod.Name, nil
+}
+
+// DrainWorker drains the tenant cluster node of the given worker. The
+// kvm-operator names tenant cluster nodes after the pods running them.
+func (k *KVM) DrainWorker(ctx context.Context, id string) error {
+	if k.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for draining workers")
+	}
+
+	workerPod, err := k.findNodePod(ctx, kvmRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = drainNode(ctx, k.tenantK8sClient, k.logger, workerPod.Name)
 	if err != nil {
 		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (k *KVM) RebootWorker(ctx context.Context, id string) error {
+	err := k.rebootNode(ctx, kvmRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// ReplaceWorker replaces the worker by changing its ID in the KVMConfig CR,
+// the same way ReplaceMaster does for masters.
+func (k *KVM) ReplaceWorker(ctx context.Context, id string) error {
+	err := k.replaceNode(ctx, kvmRoleWorker, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// PartitionMaster isolates the node of the given master from all workers for
+// the given duration using a privileged iptables DaemonSet in the tenant
+// cluster.
+func (k *KVM) PartitionMaster(ctx context.Context, id string, duration time.Duration) error {
+	if k.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for partitioning masters")
+	}
+
+	masterPod, err := k.findNodePod(ctx, kvmRoleMaster, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = partitionNode(ctx, k.tenantK8sClient, k.logger, masterPod.Name, duration)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (k *KVM) HealPartition(ctx context.Context) error {
+	if k.tenantK8sClient == nil {
+		return microerror.Maskf(invalidConfigError, "TenantK8sClient must not be empty for healing partitions")
+	}
+
+	err := healPartition(ctx, k.tenantK8sClient, k.logger)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// BackupEtcd is not supported because restoring etcd backups is a manual
+// operation for KVM tenant clusters, so a backup could not be restored.
+func (k *KVM) BackupEtcd(ctx context.Context) (string, error) {
+	return "", microerror.Maskf(notSupportedError, "backing up etcd of KVM tenant cluster %#q", k.clusterID)
+}
+
+// RestoreEtcd is not supported because restoring etcd backups is a manual
+// operation for KVM tenant clusters.
+func (k *KVM) RestoreEtcd(ctx context.Context, id string) error {
+	return microerror.Maskf(notSupportedError, "restoring etcd backup %#q of KVM tenant cluster %#q", id, k.clusterID)
+}
+
+func (k *KVM) findNodePod(ctx context.Context, role, id string) (corev1.Pod, error) {
+	listOptions := metav1.ListOptions{
+		LabelSelector: nodePodLabelSelector(role, id),
+	}
+
+	pods, err := k.k8sClient.K8sClient().CoreV1().Pods(k.clusterID).List(ctx, listOptions)
+	if err != nil {
+		return corev1.Pod{}, microerror.Mask(err)
 	} else if len(pods.Items) == 0 {
-		return microerror.Maskf(notFoundError, "master pod not found")
+		return corev1.Pod{}, microerror.Maskf(notFoundError, "%s pod for %s %#q not found", role, role, id)
 	} else if len(pods.Items) > 1 {
-		return microerror.Maskf(tooManyResultsError, "expected 1 master pod found %d", len(pods.Items))
+		return corev1.Pod{}, microerror.Maskf(tooManyResultsError, "expected 1 %s pod for %s %#q found %d", role, role, id, len(pods.Items))
+	}
+
+	return pods.Items[0], nil
+}
+
+func (k *KVM) nodeIDs(ctx context.Context, role string) ([]string, error) {
+	customObject, err := k.k8sClient.G8sClient().ProviderV1alpha1().KVMConfigs("default").Get(ctx, k.clusterID, metav1.GetOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	nodes := customObject.Spec.Cluster.Masters
+	if role == kvmRoleWorker {
+		nodes = customObject.Spec.Cluster.Workers
+	}
+
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+
+	return ids, nil
+}
+
+func (k *KVM) rebootNode(ctx context.Context, role, id string) error {
+	pod, err := k.findNodePod(ctx, role, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = k.k8sClient.K8sClient().CoreV1().Pods(k.clusterID).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (k *KVM) replaceNode(ctx context.Context, role, id string) error {
+	oldPod, err := k.findNodePod(ctx, role, id)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	newID := rand.String(5)
+	{
+		ids, err := k.nodeIDs(ctx, role)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		index := -1
+		for i, nodeID := range ids {
+			if nodeID == id {
+				index = i
+			}
+		}
+		if index == -1 {
+			return microerror.Maskf(notFoundError, "%s %#q in KVMConfig", role, id)
+		}
+
+		k.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("replacing %s %#q with %s %#q", role, id, role, newID))
+
+		path := fmt.Sprintf("/spec/cluster/%ss/%d/id", role, index)
+		patches := []Patch{
+			{
+				Op:    "test",
+				Path:  path,
+				Value: id,
+			},
+			{
+				Op:    "replace",
+				Path:  path,
+				Value: newID,
+			},
+		}
+
+		b, err := json.Marshal(patches)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		_, err = k.k8sClient.G8sClient().ProviderV1alpha1().KVMConfigs("default").Patch(ctx, k.clusterID, types.JSONPatchType, b, metav1.PatchOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	err = k.waitForNodePodReplaced(ctx, role, oldPod, newID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for _, v := range oldPod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		k.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting persistent volume claim %#q of %s %#q", v.PersistentVolumeClaim.ClaimName, role, id))
+
+		err = k.k8sClient.K8sClient().CoreV1().PersistentVolumeClaims(k.clusterID).Delete(ctx, v.PersistentVolumeClaim.ClaimName, metav1.DeleteOptions{})
+		if apierrors.IsNotFound(err) {
+			// Fall through.
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// waitForNodePodReplaced waits for the given pod to be gone and the pod of
+// the given new node ID to be running.
+func (k *KVM) waitForNodePodReplaced(ctx context.Context, role string, oldPod corev1.Pod, newID string) error {
+	o := func() error {
+		_, err := k.k8sClient.K8sClient().CoreV1().Pods(k.clusterID).Get(ctx, oldPod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Fall through.
+		} else if err != nil {
+			return microerror.Mask(err)
+		} else {
+			return microerror.Maskf(waitError, "old %s pod %#q still exists", role, oldPod.Name)
+		}
+
+		newPod, err := k.findNodePod(ctx, role, newID)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		if newPod.Status.Phase != corev1.PodRunning {
+			return microerror.Maskf(waitError, "new %s pod %#q is %#q", role, newPod.Name, newPod.Status.Phase)
+		}
+
+		return nil
 	}
 
-	masterPod := pods.Items[0]
-	err = k.k8sClient.K8sClient().CoreV1().Pods(namespace).Delete(ctx, masterPod.Name, metav1.DeleteOptions{})
+	n := func(err error, t time.Duration) {
+		k.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for %s pod to be replaced: retrying in %s", role, t), "stack", fmt.Sprintf("%v", err))
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	err := backoff.RetryNotify(o, b, n)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
 	return nil
 }
+
+// nodePodLabelSelector selects the pod of the node identified by the given
+// role and ID. The kvm-operator labels node pods with their role and ID.
+func nodePodLabelSelector(role, id string) string {
+	return fmt.Sprintf("app=%s,node=%s", role, id)
+}
@@ -0,0 +1,245 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclient"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	partitionImage     = "quay.io/giantswarm/alpine:3.12"
+	partitionName      = "e2e-network-partition"
+	partitionNamespace = metav1.NamespaceSystem
+
+	// partitionInsertDelay is the time between the partition pods reporting
+	// readiness and inserting their iptables rules. Once the rules are in
+	// place the kubelets of single master clusters cannot report anything to
+	// the API server anymore, so readiness must be observed before.
+	partitionInsertDelay = 30 * time.Second
+	// partitionReadyFile is created by the partition pods right before they
+	// wait for partitionInsertDelay and insert their iptables rules.
+	partitionReadyFile = "/tmp/partition-ready"
+)
+
+// partitionNode isolates the given tenant cluster master node from all worker
+// nodes for the given duration. A privileged DaemonSet running on the host
+// network of every worker drops all traffic from and to the addresses of the
+// master node using iptables. The pods remove the rules on their own once the
+// duration passed, so the partition expires even if the workers cannot reach
+// the API server. partitionNode waits for all pods to reach the rule insert
+// step and for the rules to be inserted.
+func partitionNode(ctx context.Context, k8sClient k8sclient.Interface, logger micrologger.Logger, nodeName string, duration time.Duration) error {
+	var addresses []string
+	{
+		node, err := k8sClient.K8sClient().CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		for _, a := range node.Status.Addresses {
+			if a.Type == corev1.NodeInternalIP || a.Type == corev1.NodeExternalIP {
+				addresses = append(addresses, a.Address)
+			}
+		}
+		if len(addresses) == 0 {
+			return microerror.Maskf(notFoundError, "addresses of node %#q", nodeName)
+		}
+	}
+
+	{
+		logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("partitioning node %#q with addresses %v from workers", nodeName, addresses))
+
+		_, err := k8sClient.K8sClient().AppsV1().DaemonSets(partitionNamespace).Create(ctx, newPartitionDaemonSet(nodeName, addresses, duration), metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		o := func() error {
+			ds, err := k8sClient.K8sClient().AppsV1().DaemonSets(partitionNamespace).Get(ctx, partitionName, metav1.GetOptions{})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			desired := ds.Status.DesiredNumberScheduled
+			if desired == 0 || ds.Status.NumberReady < desired {
+				return microerror.Maskf(waitError, "%d of %d partition pods are ready", ds.Status.NumberReady, desired)
+			}
+
+			return nil
+		}
+
+		n := func(err error, t time.Duration) {
+			logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for partition pods to be ready: retrying in %s", t), "stack", fmt.Sprintf("%v", err))
+		}
+
+		b := backoff.NewConstant(backoff.ShortMaxWait, backoff.ShortMaxInterval)
+		err := backoff.RetryNotify(o, b, n)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting %s for partition rules to be inserted", partitionInsertDelay))
+
+		select {
+		case <-time.After(partitionInsertDelay):
+		case <-ctx.Done():
+			return microerror.Mask(ctx.Err())
+		}
+
+		logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("partitioned node %#q from workers for %s", nodeName, duration))
+	}
+
+	return nil
+}
+
+// healPartition deletes the partition DaemonSet and waits for all of its pods
+// to be gone. Terminating pods remove their iptables rules in case the
+// partition did not expire yet. Once it expired the workers can reach the API
+// server again, so that their kubelets see the deletion. It succeeds if there
+// is no partition.
+func healPartition(ctx context.Context, k8sClient k8sclient.Interface, logger micrologger.Logger) error {
+	logger.LogCtx(ctx, "level", "debug", "message", "healing network partition")
+
+	propagation := metav1.DeletePropagationForeground
+	err := k8sClient.K8sClient().AppsV1().DaemonSets(partitionNamespace).Delete(ctx, partitionName, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		// Fall through.
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	o := func() error {
+		lo := metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("app=%s", partitionName),
+		}
+		l, err := k8sClient.K8sClient().CoreV1().Pods(partitionNamespace).List(ctx, lo)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		if len(l.Items) > 0 {
+			return microerror.Maskf(waitError, "%d partition pods still exist", len(l.Items))
+		}
+
+		return nil
+	}
+
+	n := func(err error, t time.Duration) {
+		logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for partition to heal: retrying in %s", t), "stack", fmt.Sprintf("%v", err))
+	}
+
+	b := backoff.NewConstant(backoff.ShortMaxWait, backoff.ShortMaxInterval)
+	err = backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	logger.LogCtx(ctx, "level", "debug", "message", "healed network partition")
+
+	return nil
+}
+
+func newPartitionDaemonSet(nodeName string, addresses []string, duration time.Duration) *appsv1.DaemonSet {
+	// The pods report readiness right before the rule insert step, insert the
+	// rules after partitionInsertDelay, remove them after the given duration
+	// and idle afterwards. Terminating pods remove the rules as well.
+	var insert, remove []string
+	for _, a := range addresses {
+		insert = append(insert, fmt.Sprintf("iptables -I INPUT -s %[1]s -j DROP && iptables -I OUTPUT -d %[1]s -j DROP", a))
+		remove = append(remove, fmt.Sprintf("iptables -D INPUT -s %[1]s -j DROP; iptables -D OUTPUT -d %[1]s -j DROP", a))
+	}
+	script := fmt.Sprintf(
+		"apk add --no-cache iptables && trap '%[1]s; exit 0' TERM && touch %[2]s && sleep %[3]d && %[4]s && sleep %[5]d; %[1]s; while true; do sleep 1; done",
+		strings.Join(remove, "; "), partitionReadyFile, seconds(partitionInsertDelay), strings.Join(insert, " && "), seconds(duration),
+	)
+
+	labels := map[string]string{
+		"app": partitionName,
+	}
+	privileged := true
+	gracePeriod := int64(30)
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      partitionName,
+			Namespace: partitionNamespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Affinity: &corev1.Affinity{
+						NodeAffinity: &corev1.NodeAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+								NodeSelectorTerms: []corev1.NodeSelectorTerm{
+									{
+										MatchExpressions: []corev1.NodeSelectorRequirement{
+											{
+												Key:      "node-role.kubernetes.io/master",
+												Operator: corev1.NodeSelectorOpDoesNotExist,
+											},
+											{
+												Key:      corev1.LabelHostname,
+												Operator: corev1.NodeSelectorOpNotIn,
+												Values:   []string{nodeName},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "iptables",
+							Image:   partitionImage,
+							Command: []string{"sh", "-c", script},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"test", "-f", partitionReadyFile},
+									},
+								},
+								PeriodSeconds: 2,
+							},
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: &privileged,
+							},
+						},
+					},
+					HostNetwork:                   true,
+					TerminationGracePeriodSeconds: &gracePeriod,
+					Tolerations: []corev1.Toleration{
+						{
+							Operator: corev1.TolerationOpExists,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// seconds returns the given duration in whole seconds, rounded up.
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_newPartitionDaemonSet(t *testing.T) {
+	testCases := []struct {
+		name           string
+		addresses      []string
+		duration       time.Duration
+		expectedScript string
+	}{
+		{
+			name:      "case 0: one address",
+			addresses: []string{"10.0.0.1"},
+			duration:  6 * time.Minute,
+			expectedScript: "apk add --no-cache iptables && " +
+				"trap 'iptables -D INPUT -s 10.0.0.1 -j DROP; iptables -D OUTPUT -d 10.0.0.1 -j DROP; exit 0' TERM && " +
+				"touch /tmp/partition-ready && sleep 30 && " +
+				"iptables -I INPUT -s 10.0.0.1 -j DROP && iptables -I OUTPUT -d 10.0.0.1 -j DROP && sleep 360; " +
+				"iptables -D INPUT -s 10.0.0.1 -j DROP; iptables -D OUTPUT -d 10.0.0.1 -j DROP; " +
+				"while true; do sleep 1; done",
+		},
+		{
+			name:      "case 1: two addresses and duration rounded up",
+			addresses: []string{"10.0.0.1", "1.2.3.4"},
+			duration:  1500 * time.Millisecond,
+			expectedScript: "apk add --no-cache iptables && " +
+				"trap 'iptables -D INPUT -s 10.0.0.1 -j DROP; iptables -D OUTPUT -d 10.0.0.1 -j DROP; iptables -D INPUT -s 1.2.3.4 -j DROP; iptables -D OUTPUT -d 1.2.3.4 -j DROP; exit 0' TERM && " +
+				"touch /tmp/partition-ready && sleep 30 && " +
+				"iptables -I INPUT -s 10.0.0.1 -j DROP && iptables -I OUTPUT -d 10.0.0.1 -j DROP && iptables -I INPUT -s 1.2.3.4 -j DROP && iptables -I OUTPUT -d 1.2.3.4 -j DROP && sleep 2; " +
+				"iptables -D INPUT -s 10.0.0.1 -j DROP; iptables -D OUTPUT -d 10.0.0.1 -j DROP; iptables -D INPUT -s 1.2.3.4 -j DROP; iptables -D OUTPUT -d 1.2.3.4 -j DROP; " +
+				"while true; do sleep 1; done",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ds := newPartitionDaemonSet("master", tc.addresses, tc.duration)
+
+			script := ds.Spec.Template.Spec.Containers[0].Command[2]
+			if script != tc.expectedScript {
+				t.Fatalf("%s: script == %q, want %q", tc.name, script, tc.expectedScript)
+			}
+		})
+	}
+}
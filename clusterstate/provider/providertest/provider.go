@@ -0,0 +1,174 @@
+package providertest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider"
+)
+
+var _ provider.Interface = &Provider{}
+
+type Config struct {
+	// Masters are the master IDs returned by Masters.
+	Masters []string
+	// Workers are the worker IDs returned by Workers.
+	Workers []string
+
+	// Disrupt is called by all methods disrupting nodes if set. The given
+	// method is the name of the called method, e.g. "RebootMaster". The ID is
+	// empty for HealPartition.
+	Disrupt func(ctx context.Context, method, id string) error
+	// NodeName is called by MasterNodeName and WorkerNodeName if set.
+	// Otherwise they return master-<id> and worker-<id>, like
+	// clusterstatetest.Cluster names the nodes it is seeded with.
+	NodeName func(ctx context.Context, id string) (string, error)
+
+	// BackupEtcd is called by BackupEtcd if set. Otherwise BackupEtcd returns
+	// a backup ID of the form backup-<n>.
+	BackupEtcd func(ctx context.Context) (string, error)
+	// RestoreEtcd is called by RestoreEtcd if set.
+	RestoreEtcd func(ctx context.Context, id string) error
+}
+
+// Provider is a fake provider.Interface implementation which records all
+// calls, so that the step logic of clusterstate can be tested without real
+// infrastructure.
+type Provider struct {
+	masters []string
+	workers []string
+
+	disrupt     func(ctx context.Context, method, id string) error
+	nodeName    func(ctx context.Context, id string) (string, error)
+	backupEtcd  func(ctx context.Context) (string, error)
+	restoreEtcd func(ctx context.Context, id string) error
+
+	mutex   sync.Mutex
+	calls   []string
+	backups int
+}
+
+func New(config Config) *Provider {
+	p := &Provider{
+		masters: config.Masters,
+		workers: config.Workers,
+
+		disrupt:     config.Disrupt,
+		nodeName:    config.NodeName,
+		backupEtcd:  config.BackupEtcd,
+		restoreEtcd: config.RestoreEtcd,
+	}
+
+	return p
+}
+
+// Calls returns all calls made to the provider in order, e.g.
+// "RebootMaster(m1)". Node name lookups are not recorded.
+func (p *Provider) Calls() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]string(nil), p.calls...)
+}
+
+func (p *Provider) Masters(ctx context.Context) ([]string, error) {
+	p.record("Masters()")
+	return p.masters, nil
+}
+
+func (p *Provider) MasterNodeName(ctx context.Context, id string) (string, error) {
+	if p.nodeName != nil {
+		return p.nodeName(ctx, id)
+	}
+
+	return fmt.Sprintf("master-%s", id), nil
+}
+
+func (p *Provider) RebootMaster(ctx context.Context, id string) error {
+	p.record(fmt.Sprintf("RebootMaster(%s)", id))
+	return p.callDisrupt(ctx, "RebootMaster", id)
+}
+
+func (p *Provider) ReplaceMaster(ctx context.Context, id string) error {
+	p.record(fmt.Sprintf("ReplaceMaster(%s)", id))
+	return p.callDisrupt(ctx, "ReplaceMaster", id)
+}
+
+func (p *Provider) Workers(ctx context.Context) ([]string, error) {
+	p.record("Workers()")
+	return p.workers, nil
+}
+
+func (p *Provider) WorkerNodeName(ctx context.Context, id string) (string, error) {
+	if p.nodeName != nil {
+		return p.nodeName(ctx, id)
+	}
+
+	return fmt.Sprintf("worker-%s", id), nil
+}
+
+func (p *Provider) DrainWorker(ctx context.Context, id string) error {
+	p.record(fmt.Sprintf("DrainWorker(%s)", id))
+	return p.callDisrupt(ctx, "DrainWorker", id)
+}
+
+func (p *Provider) RebootWorker(ctx context.Context, id string) error {
+	p.record(fmt.Sprintf("RebootWorker(%s)", id))
+	return p.callDisrupt(ctx, "RebootWorker", id)
+}
+
+func (p *Provider) ReplaceWorker(ctx context.Context, id string) error {
+	p.record(fmt.Sprintf("ReplaceWorker(%s)", id))
+	return p.callDisrupt(ctx, "ReplaceWorker", id)
+}
+
+func (p *Provider) PartitionMaster(ctx context.Context, id string, duration time.Duration) error {
+	p.record(fmt.Sprintf("PartitionMaster(%s)", id))
+	return p.callDisrupt(ctx, "PartitionMaster", id)
+}
+
+func (p *Provider) HealPartition(ctx context.Context) error {
+	p.record("HealPartition()")
+	return p.callDisrupt(ctx, "HealPartition", "")
+}
+
+func (p *Provider) BackupEtcd(ctx context.Context) (string, error) {
+	p.record("BackupEtcd()")
+
+	if p.backupEtcd != nil {
+		return p.backupEtcd(ctx)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.backups++
+
+	return fmt.Sprintf("backup-%d", p.backups), nil
+}
+
+func (p *Provider) RestoreEtcd(ctx context.Context, id string) error {
+	p.record(fmt.Sprintf("RestoreEtcd(%s)", id))
+
+	if p.restoreEtcd != nil {
+		return p.restoreEtcd(ctx, id)
+	}
+
+	return nil
+}
+
+func (p *Provider) callDisrupt(ctx context.Context, method, id string) error {
+	if p.disrupt != nil {
+		return p.disrupt(ctx, method, id)
+	}
+
+	return nil
+}
+
+func (p *Provider) record(call string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.calls = append(p.calls, call)
+}
@@ -1,6 +1,63 @@
 package provider
 
+import (
+	"context"
+	"time"
+)
+
 type Interface interface {
-	RebootMaster() error
-	ReplaceMaster() error
+	// Masters returns the provider specific IDs of all master nodes of the
+	// tenant cluster.
+	Masters(ctx context.Context) ([]string, error)
+	// MasterNodeName returns the name of the tenant cluster node of the master
+	// identified by the given ID.
+	MasterNodeName(ctx context.Context, id string) (string, error)
+	// RebootMaster reboots the master node identified by the given ID. The
+	// implementation does not wait for the tenant cluster to be ready again.
+	RebootMaster(ctx context.Context, id string) error
+	// ReplaceMaster replaces the master node identified by the given ID with a
+	// new node using fresh storage and a new node identity. The implementation
+	// does not wait for the tenant cluster to be ready again.
+	ReplaceMaster(ctx context.Context, id string) error
+
+	// Workers returns the provider specific IDs of all worker nodes of the
+	// tenant cluster.
+	Workers(ctx context.Context) ([]string, error)
+	// WorkerNodeName returns the name of the tenant cluster node of the worker
+	// identified by the given ID.
+	WorkerNodeName(ctx context.Context, id string) (string, error)
+	// DrainWorker cordons the worker node identified by the given ID and
+	// evicts all pods running on it. The node stays unschedulable.
+	DrainWorker(ctx context.Context, id string) error
+	// RebootWorker reboots the worker node identified by the given ID. The
+	// implementation does not wait for the node to be ready again.
+	RebootWorker(ctx context.Context, id string) error
+	// ReplaceWorker replaces the worker node identified by the given ID with a
+	// new node. The implementation does not wait for the new node to be ready.
+	ReplaceWorker(ctx context.Context, id string) error
+
+	// PartitionMaster isolates the master node identified by the given ID from
+	// all worker nodes on the network level for the given duration. The
+	// partition expires on its own, so that it does not depend on the tenant
+	// cluster API being reachable. The implementation waits for the partition
+	// to be in place.
+	PartitionMaster(ctx context.Context, id string, duration time.Duration) error
+	// HealPartition cleans up the network partition created by PartitionMaster
+	// and removes it early if it did not expire yet. It succeeds if there is
+	// no partition.
+	HealPartition(ctx context.Context) error
+
+	// BackupEtcd creates a backup of the tenant cluster etcd and returns its
+	// ID once the backup completed.
+	BackupEtcd(ctx context.Context) (string, error)
+	// RestoreEtcd restores the tenant cluster etcd from the backup identified
+	// by the given ID. The implementation does not wait for the tenant cluster
+	// to be ready again.
+	RestoreEtcd(ctx context.Context, id string) error
+}
+
+type Patch struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
 }
@@ -0,0 +1,129 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+)
+
+// DowntimeWindow is a period in which the tenant cluster Kubernetes API was
+// unavailable.
+type DowntimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (w DowntimeWindow) Duration() time.Duration {
+	return w.End.Sub(w.Start)
+}
+
+// DisruptionResult describes a single disruption of the tenant cluster.
+type DisruptionResult struct {
+	// Action describes the disruption, e.g. "rebooting master".
+	Action string
+	// Targets are the provider specific IDs of the disrupted nodes.
+	Targets []string
+	// Started is the time the disruption started.
+	Started time.Time
+	// Downtime lists the windows in which the API was unavailable, measured
+	// from the start of the disruption until the tenant cluster was ready.
+	Downtime []DowntimeWindow
+	// TimeToReady is the time from the start of the disruption until the
+	// tenant cluster was ready again.
+	TimeToReady time.Duration
+}
+
+// TotalDowntime returns the sum of all downtime windows.
+func (r DisruptionResult) TotalDowntime() time.Duration {
+	var d time.Duration
+	for _, w := range r.Downtime {
+		d += w.Duration()
+	}
+
+	return d
+}
+
+// LongestDowntime returns the duration of the longest downtime window.
+func (r DisruptionResult) LongestDowntime() time.Duration {
+	var d time.Duration
+	for _, w := range r.Downtime {
+		if w.Duration() > d {
+			d = w.Duration()
+		}
+	}
+
+	return d
+}
+
+// Result is the result of a scenario run.
+type Result struct {
+	Scenario    string
+	Disruptions []DisruptionResult
+	// HealthChecks holds the results of all health gate runs.
+	HealthChecks []HealthCheck
+}
+
+// disruption measures the API downtime and the time to ready of a single
+// disruption.
+type disruption struct {
+	probe  *apiProbe
+	result DisruptionResult
+
+	once sync.Once
+}
+
+func (c *ClusterState) startDisruption(ctx context.Context, action string, targets ...string) *disruption {
+	d := &disruption{
+		probe: c.startAPIProbe(ctx),
+		result: DisruptionResult{
+			Action:  action,
+			Targets: targets,
+			Started: time.Now(),
+		},
+	}
+
+	return d
+}
+
+// ready stops measuring and returns the result of the disruption. It is safe
+// to call ready multiple times, e.g. deferred to stop the API probe on
+// errors. Only the first call determines the result.
+func (d *disruption) ready() DisruptionResult {
+	d.once.Do(func() {
+		d.result.TimeToReady = time.Since(d.result.Started)
+		d.result.Downtime = d.probe.stop()
+	})
+
+	return d.result
+}
+
+// Result returns the result of the last scenario run. Disruptions of failed
+// runs are included up to the failing step.
+func (c *ClusterState) Result() Result {
+	c.resultMutex.Lock()
+	defer c.resultMutex.Unlock()
+
+	return c.result
+}
+
+func (s *State) addDisruption(r DisruptionResult) {
+	s.result.Disruptions = append(s.result.Disruptions, r)
+}
+
+// recordDisruption adds the given result to the given state and ensures the
+// tenant cluster recovered within the configured recovery budget.
+func (c *ClusterState) recordDisruption(ctx context.Context, state *State, r DisruptionResult) error {
+	state.addDisruption(r)
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("%s %s: api was down for %s in %d windows, cluster was ready after %s", r.Action, strings.Join(r.Targets, ", "), r.TotalDowntime(), len(r.Downtime), r.TimeToReady))
+
+	if r.TimeToReady > c.maxRecoveryTime {
+		return microerror.Maskf(recoveryBudgetExceededError, "cluster was ready after %s when %s %s, allowed are %s", r.TimeToReady, r.Action, strings.Join(r.Targets, ", "), c.maxRecoveryTime)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package clusterstate
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+func Test_DisruptionResult_Downtime(t *testing.T) {
+	start := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		downtime        []DowntimeWindow
+		expectedTotal   time.Duration
+		expectedLongest time.Duration
+	}{
+		{
+			name:            "case 0: no downtime",
+			downtime:        nil,
+			expectedTotal:   0,
+			expectedLongest: 0,
+		},
+		{
+			name: "case 1: multiple windows",
+			downtime: []DowntimeWindow{
+				{Start: start, End: start.Add(10 * time.Second)},
+				{Start: start.Add(time.Minute), End: start.Add(time.Minute + 30*time.Second)},
+				{Start: start.Add(2 * time.Minute), End: start.Add(2*time.Minute + 5*time.Second)},
+			},
+			expectedTotal:   45 * time.Second,
+			expectedLongest: 30 * time.Second,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			r := DisruptionResult{Downtime: tc.downtime}
+
+			if r.TotalDowntime() != tc.expectedTotal {
+				t.Fatalf("%s: total downtime == %s, want %s", tc.name, r.TotalDowntime(), tc.expectedTotal)
+			}
+			if r.LongestDowntime() != tc.expectedLongest {
+				t.Fatalf("%s: longest downtime == %s, want %s", tc.name, r.LongestDowntime(), tc.expectedLongest)
+			}
+		})
+	}
+}
+
+func Test_ClusterState_Result(t *testing.T) {
+	testCases := []struct {
+		name                string
+		maxRecoveryTime     time.Duration
+		expectedDisruptions int
+		errorMatcher        func(error) bool
+	}{
+		{
+			name:                "case 0: recovery within budget",
+			maxRecoveryTime:     time.Minute,
+			expectedDisruptions: 2,
+			errorMatcher:        nil,
+		},
+		{
+			name:                "case 1: recovery exceeds budget",
+			maxRecoveryTime:     time.Nanosecond,
+			expectedDisruptions: 1,
+			errorMatcher:        IsRecoveryBudgetExceeded,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(newMasterNode("master-m1"))
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        providertest.New(providertest.Config{Masters: []string{"m1"}, Disrupt: rebootNodes(k8sClient)}),
+
+				HealthGate:      HealthGateConfig{Disabled: true},
+				MaxRecoveryTime: tc.maxRecoveryTime,
+				Scenario: &Scenario{
+					Name: "reboot twice",
+					Steps: []Step{
+						RebootMasters(),
+						RebootMasters(),
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.Test(context.Background())
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			r := c.Result()
+			if r.Scenario != "reboot twice" {
+				t.Fatalf("%s: scenario == %#q, want %#q", tc.name, r.Scenario, "reboot twice")
+			}
+			if len(r.Disruptions) != tc.expectedDisruptions {
+				t.Fatalf("%s: disruptions == %d, want %d", tc.name, len(r.Disruptions), tc.expectedDisruptions)
+			}
+			for _, d := range r.Disruptions {
+				if d.Action != "rebooting master" {
+					t.Fatalf("%s: action == %#q, want %#q", tc.name, d.Action, "rebooting master")
+				}
+				if len(d.Downtime) != 0 {
+					t.Fatalf("%s: downtime windows == %d, want 0", tc.name, len(d.Downtime))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/giantswarm/microerror"
+)
+
+// StepKind describes what a step does. It is only used for logging.
+type StepKind string
+
+const (
+	// StepKindAction steps change the tenant cluster, e.g. by rebooting
+	// nodes or installing workloads.
+	StepKindAction StepKind = "action"
+	// StepKindWait steps wait for the tenant cluster to reach a state.
+	StepKindWait StepKind = "wait"
+	// StepKindAssert steps check the tenant cluster is in the expected state.
+	StepKindAssert StepKind = "assert"
+)
+
+// Step is a single named step of a Scenario.
+type Step struct {
+	Name string
+	Kind StepKind
+	// Run executes the step. The given state is shared between all steps of
+	// a scenario run.
+	Run func(ctx context.Context, c *ClusterState, state *State) error
+}
+
+// Scenario is a named list of steps executed in order. The first failing
+// step aborts the scenario.
+type Scenario struct {
+	Name  string
+	Steps []Step
+}
+
+// State is shared between all steps of a scenario run. It carries the
+// objects created by earlier steps, which later steps check.
+type State struct {
+	cleanups []func(ctx context.Context) error
+
+	healthProbeInstalled bool
+	result               Result
+	sentinels            []sentinel
+	statefulWorkload     *statefulWorkload
+	testAppInstalled     bool
+}
+
+// AddCleanup registers the given function to be called after the scenario
+// finished, regardless of its result. Cleanups are called in reverse order of
+// registration.
+func (s *State) AddCleanup(f func(ctx context.Context) error) {
+	s.cleanups = append(s.cleanups, f)
+}
+
+// Without returns a copy of the scenario without the steps with the given
+// name.
+func (s Scenario) Without(name string) Scenario {
+	scenario := Scenario{
+		Name: s.Name,
+	}
+
+	for _, step := range s.Steps {
+		if step.Name != name {
+			scenario.Steps = append(scenario.Steps, step)
+		}
+	}
+
+	return scenario
+}
+
+// DefaultScenario returns the scenario executed by Test unless another
+// scenario is configured. It installs the test app, writes sentinel objects,
+// installs a stateful workload and then reboots and replaces the masters,
+// reboots, drains and replaces a worker and checks the cluster state after
+// every recovery.
+func DefaultScenario() Scenario {
+	return Scenario{
+		Name: "default",
+		Steps: []Step{
+			InstallTestApp(),
+			CheckTestApp(),
+			WriteSentinels(),
+			InstallStatefulWorkload(),
+			RebootMasters(),
+			ReplaceMasters(),
+			RebootWorker(),
+			DrainWorker(),
+			ReplaceWorker(),
+		},
+	}
+}
+
+// Run executes the given scenario and calls all registered cleanups
+// afterwards.
+func (c *ClusterState) Run(ctx context.Context, scenario Scenario) error {
+	err := validateScenario(scenario)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	state := &State{
+		result: Result{
+			Scenario: scenario.Name,
+		},
+	}
+
+	defer func() {
+		c.resultMutex.Lock()
+		c.result = state.result
+		c.resultMutex.Unlock()
+	}()
+
+	defer func() {
+		if c.keepResources {
+			c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("keeping resources, skipping %d cleanups", len(state.cleanups)))
+			return
+		}
+
+		for i := len(state.cleanups) - 1; i >= 0; i-- {
+			err := state.cleanups[i](ctx)
+			if err != nil {
+				c.logger.LogCtx(ctx, "level", "error", "message", "failed to clean up", "stack", fmt.Sprintf("%#v", err))
+			}
+		}
+	}()
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("running scenario %#q", scenario.Name))
+
+	for i, step := range scenario.Steps {
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("running %s step %d/%d %#q", step.Kind, i+1, len(scenario.Steps), step.Name))
+
+		err = step.Run(ctx, c, state)
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "error", "message", fmt.Sprintf("step %#q of scenario %#q failed", step.Name, scenario.Name), "stack", fmt.Sprintf("%#v", err))
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ran %s step %d/%d %#q", step.Kind, i+1, len(scenario.Steps), step.Name))
+	}
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ran scenario %#q", scenario.Name))
+
+	return nil
+}
+
+func validateScenario(scenario Scenario) error {
+	if scenario.Name == "" {
+		return microerror.Maskf(invalidConfigError, "scenario name must not be empty")
+	}
+	if len(scenario.Steps) == 0 {
+		return microerror.Maskf(invalidConfigError, "scenario %#q must have steps", scenario.Name)
+	}
+
+	for i, step := range scenario.Steps {
+		if step.Name == "" {
+			return microerror.Maskf(invalidConfigError, "name of step %d of scenario %#q must not be empty", i, scenario.Name)
+		}
+		if step.Run == nil {
+			return microerror.Maskf(invalidConfigError, "step %#q of scenario %#q must have a run function", step.Name, scenario.Name)
+		}
+	}
+
+	return nil
+}
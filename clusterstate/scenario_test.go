@@ -0,0 +1,152 @@
+package clusterstate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/clusterstatetest"
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+var errStepFailed = errors.New("step failed")
+
+func Test_ClusterState_Run(t *testing.T) {
+	var events []string
+
+	recordStep := func(name string, err error) Step {
+		return Step{
+			Name: name,
+			Kind: StepKindAction,
+			Run: func(ctx context.Context, c *ClusterState, state *State) error {
+				events = append(events, name)
+				state.AddCleanup(func(ctx context.Context) error {
+					events = append(events, "cleanup "+name)
+					return nil
+				})
+				return err
+			},
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		scenario       Scenario
+		masters        []string
+		expectedEvents []string
+		expectedCalls  []string
+		errorMatcher   func(error) bool
+	}{
+		{
+			name: "case 0: steps run in order and cleanups in reverse order",
+			scenario: Scenario{
+				Name: "test",
+				Steps: []Step{
+					recordStep("a", nil),
+					recordStep("b", nil),
+				},
+			},
+			expectedEvents: []string{"a", "b", "cleanup b", "cleanup a"},
+			errorMatcher:   nil,
+		},
+		{
+			name: "case 1: failing step aborts scenario and cleanups still run",
+			scenario: Scenario{
+				Name: "test",
+				Steps: []Step{
+					recordStep("a", nil),
+					recordStep("b", errStepFailed),
+					recordStep("c", nil),
+				},
+			},
+			expectedEvents: []string{"a", "b", "cleanup b", "cleanup a"},
+			errorMatcher: func(err error) bool {
+				return microerror.Cause(err) == errStepFailed
+			},
+		},
+		{
+			name: "case 2: reboot single master twice",
+			scenario: Scenario{
+				Name: "reboot twice",
+				Steps: []Step{
+					RebootMasters(),
+					RebootMasters(),
+				},
+			},
+			masters:       []string{"m1"},
+			expectedCalls: []string{"Masters()", "RebootMaster(m1)", "Masters()", "RebootMaster(m1)"},
+			errorMatcher:  nil,
+		},
+		{
+			name: "case 3: step without run function is rejected",
+			scenario: Scenario{
+				Name: "test",
+				Steps: []Step{
+					{Name: "a"},
+				},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 4: masters not found",
+			scenario: Scenario{
+				Name: "test",
+				Steps: []Step{
+					RebootMasters(),
+				},
+			},
+			expectedCalls: []string{"Masters()"},
+			errorMatcher:  IsNotFound,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			events = nil
+
+			k8sClient := fake.NewSimpleClientset(newMasterNode("master-m1"))
+
+			p := providertest.New(providertest.Config{
+				Masters: tc.masters,
+				Disrupt: rebootNodes(k8sClient),
+			})
+
+			c, err := New(Config{
+				K8sClient:       k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				LegacyFramework: clusterstatetest.NewFramework(clusterstatetest.FrameworkConfig{}),
+				Logger:          microloggertest.New(),
+				Provider:        p,
+
+				HealthGate: HealthGateConfig{Disabled: true},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.Run(context.Background(), tc.scenario)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if !reflect.DeepEqual(events, tc.expectedEvents) {
+				t.Fatalf("%s: events == %v, want %v", tc.name, events, tc.expectedEvents)
+			}
+			if !reflect.DeepEqual(p.Calls(), tc.expectedCalls) {
+				t.Fatalf("%s: calls == %v, want %v", tc.name, p.Calls(), tc.expectedCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	sentinelConfigMapCount = 3
+	sentinelCRDGroup       = "e2etests.giantswarm.io"
+	sentinelCRDKind        = "Sentinel"
+	sentinelCRDPlural      = "sentinels"
+	sentinelCRDVersion     = "v1alpha1"
+	sentinelNamespace      = "e2e-sentinel"
+)
+
+var (
+	sentinelCRDName = fmt.Sprintf("%s.%s", sentinelCRDPlural, sentinelCRDGroup)
+	sentinelGVR     = schema.GroupVersionResource{
+		Group:    sentinelCRDGroup,
+		Version:  sentinelCRDVersion,
+		Resource: sentinelCRDPlural,
+	}
+)
+
+// sentinel is an object written to the tenant cluster before disrupting it.
+// Its identity and content must survive all disruptions unchanged.
+type sentinel struct {
+	kind      string
+	namespace string
+	name      string
+
+	uid             types.UID
+	resourceVersion string
+	content         interface{}
+}
+
+func (s sentinel) String() string {
+	if s.namespace == "" {
+		return fmt.Sprintf("%s %#q", s.kind, s.name)
+	}
+
+	return fmt.Sprintf("%s %#q in namespace %#q", s.kind, s.name, s.namespace)
+}
+
+// writeSentinels creates a set of sentinel objects with random content in the
+// tenant cluster and returns their identities and content.
+func (c *ClusterState) writeSentinels(ctx context.Context) ([]sentinel, error) {
+	var sentinels []sentinel
+
+	{
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: sentinelNamespace,
+				Annotations: map[string]string{
+					"e2etests.giantswarm.io/sentinel": rand.String(32),
+				},
+			},
+		}
+
+		ns, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		sentinels = append(sentinels, sentinel{
+			kind:            "namespace",
+			name:            ns.Name,
+			uid:             ns.UID,
+			resourceVersion: ns.ResourceVersion,
+			content:         ns.Annotations,
+		})
+	}
+
+	for i := 0; i < sentinelConfigMapCount; i++ {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("sentinel-%d", i),
+				Namespace: sentinelNamespace,
+			},
+			Data: map[string]string{
+				"sentinel": rand.String(64),
+			},
+		}
+
+		cm, err := c.k8sClient.K8sClient().CoreV1().ConfigMaps(sentinelNamespace).Create(ctx, cm, metav1.CreateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		sentinels = append(sentinels, sentinel{
+			kind:            "configmap",
+			namespace:       cm.Namespace,
+			name:            cm.Name,
+			uid:             cm.UID,
+			resourceVersion: cm.ResourceVersion,
+			content:         cm.Data,
+		})
+	}
+
+	{
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sentinel",
+				Namespace: sentinelNamespace,
+			},
+			Data: map[string][]byte{
+				"sentinel": []byte(rand.String(64)),
+			},
+		}
+
+		secret, err := c.k8sClient.K8sClient().CoreV1().Secrets(sentinelNamespace).Create(ctx, secret, metav1.CreateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		sentinels = append(sentinels, sentinel{
+			kind:            "secret",
+			namespace:       secret.Namespace,
+			name:            secret.Name,
+			uid:             secret.UID,
+			resourceVersion: secret.ResourceVersion,
+			content:         secret.Data,
+		})
+	}
+
+	{
+		err := c.ensureSentinelCRD(ctx)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		cr := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": sentinelGVR.GroupVersion().String(),
+				"kind":       sentinelCRDKind,
+				"metadata": map[string]interface{}{
+					"name":      "sentinel",
+					"namespace": sentinelNamespace,
+				},
+				"spec": map[string]interface{}{
+					"sentinel": rand.String(64),
+				},
+			},
+		}
+
+		cr, err = c.k8sClient.DynClient().Resource(sentinelGVR).Namespace(sentinelNamespace).Create(ctx, cr, metav1.CreateOptions{})
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		sentinels = append(sentinels, sentinel{
+			kind:            "custom resource",
+			namespace:       cr.GetNamespace(),
+			name:            cr.GetName(),
+			uid:             cr.GetUID(),
+			resourceVersion: cr.GetResourceVersion(),
+			content:         cr.Object["spec"],
+		})
+	}
+
+	return sentinels, nil
+}
+
+// verifySentinels ensures that all given sentinel objects still exist with
+// the same UID, resource version and content.
+func (c *ClusterState) verifySentinels(ctx context.Context, sentinels []sentinel) error {
+	for _, s := range sentinels {
+		current, err := c.getSentinel(ctx, s)
+		if apierrors.IsNotFound(err) {
+			return microerror.Maskf(sentinelMismatchError, "%s does not exist anymore", s)
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		if current.uid != s.uid {
+			return microerror.Maskf(sentinelMismatchError, "%s has UID %#q, want %#q", s, current.uid, s.uid)
+		}
+		if current.resourceVersion != s.resourceVersion {
+			return microerror.Maskf(sentinelMismatchError, "%s has resource version %#q, want %#q", s, current.resourceVersion, s.resourceVersion)
+		}
+		if !reflect.DeepEqual(current.content, s.content) {
+			return microerror.Maskf(sentinelMismatchError, "%s content changed", s)
+		}
+	}
+
+	return nil
+}
+
+// deleteSentinels deletes the sentinel namespace, including all objects
+// inside of it, and the sentinel CRD. It waits for the namespace to be gone.
+func (c *ClusterState) deleteSentinels(ctx context.Context) error {
+	err := c.deleteNamespace(ctx, sentinelNamespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = c.k8sClient.ExtClient().ApiextensionsV1().CustomResourceDefinitions().Delete(ctx, sentinelCRDName, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		// Fall through.
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *ClusterState) ensureSentinelCRD(ctx context.Context) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: sentinelCRDName,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: sentinelCRDGroup,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     sentinelCRDKind,
+				Plural:   sentinelCRDPlural,
+				Singular: "sentinel",
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    sentinelCRDVersion,
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"spec": {
+									Type:                   "object",
+									XPreserveUnknownFields: boolPtr(true),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := c.k8sClient.ExtClient().ApiextensionsV1().CustomResourceDefinitions().Create(ctx, crd, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// Fall through.
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	o := func() error {
+		crd, err := c.k8sClient.ExtClient().ApiextensionsV1().CustomResourceDefinitions().Get(ctx, sentinelCRDName, metav1.GetOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		for _, cond := range crd.Status.Conditions {
+			if cond.Type == apiextensionsv1.Established && cond.Status == apiextensionsv1.ConditionTrue {
+				return nil
+			}
+		}
+
+		return microerror.Maskf(waitError, "crd %#q is not established", sentinelCRDName)
+	}
+
+	b := backoff.NewConstant(backoff.ShortMaxWait, backoff.ShortMaxInterval)
+	n := func(err error, delay time.Duration) {
+		c.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err = backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *ClusterState) getSentinel(ctx context.Context, s sentinel) (sentinel, error) {
+	var obj metav1.Object
+	var content interface{}
+
+	switch s.kind {
+	case "namespace":
+		ns, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return sentinel{}, err
+		}
+		obj, content = ns, ns.Annotations
+	case "configmap":
+		cm, err := c.k8sClient.K8sClient().CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return sentinel{}, err
+		}
+		obj, content = cm, cm.Data
+	case "secret":
+		secret, err := c.k8sClient.K8sClient().CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return sentinel{}, err
+		}
+		obj, content = secret, secret.Data
+	case "custom resource":
+		cr, err := c.k8sClient.DynClient().Resource(sentinelGVR).Namespace(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return sentinel{}, err
+		}
+		obj, content = cr, cr.Object["spec"]
+	default:
+		return sentinel{}, microerror.Maskf(invalidConfigError, "unknown sentinel kind %#q", s.kind)
+	}
+
+	current := sentinel{
+		kind:      s.kind,
+		namespace: obj.GetNamespace(),
+		name:      obj.GetName(),
+
+		uid:             obj.GetUID(),
+		resourceVersion: obj.GetResourceVersion(),
+		content:         content,
+	}
+
+	return current, nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -2,6 +2,7 @@ package clusterstate
 
 import (
 	"context"
+	"time"
 )
 
 const (
@@ -12,9 +13,50 @@ const (
 	ChartNamespace  = "e2e-app"
 )
 
+const (
+	defaultClusterDomain                = "cluster.local"
+	defaultDisruptionEvidenceTimeout    = 5 * time.Minute
+	defaultMaxAPIUnavailability         = 30 * time.Second
+	defaultMaxRecoveryTime              = 15 * time.Minute
+	defaultNetworkPartitionDuration     = 6 * time.Minute
+	defaultStatefulWorkloadDatasetFiles = 16
+	defaultTestAppPodCount              = 2
+	defaultTestAppPodLabelSelector      = "app=e2e-app"
+)
+
+const (
+	// managedByLabel marks namespaces created by the cluster state test. Only
+	// these namespaces, e.g. of the test app and the stateful workload, are
+	// deleted after the test.
+	managedByLabel = "giantswarm.io/managed-by"
+	managedByValue = "e2etests"
+)
+
+const (
+	masterNodeLabelSelector = "node-role.kubernetes.io/master"
+	workerNodeLabelSelector = "!node-role.kubernetes.io/master"
+)
+
+// MasterDisruptionMode defines how the masters of HA clusters are disrupted.
+type MasterDisruptionMode string
+
+const (
+	// MasterDisruptionOneByOne disrupts one master at a time and expects the
+	// API to stay available. This is the default.
+	MasterDisruptionOneByOne MasterDisruptionMode = "oneByOne"
+	// MasterDisruptionAll disrupts all masters at once and expects the API to
+	// go down.
+	MasterDisruptionAll MasterDisruptionMode = "all"
+)
+
+// LegacyFramework waits for state changes of the tenant cluster. It is
+// implemented by the legacy e2e framework and by NativeFramework.
 type LegacyFramework interface {
 	// WaitForAPIUp waits for the currently configured tenant cluster Kubernetes
 	// API to be down.
+	//
+	// Deprecated: the cluster state test detects disruptions using restart
+	// evidence instead and does not call WaitForAPIDown anymore.
 	WaitForAPIDown() error
 	// WaitForGuestReady waits for the currently configured tenant cluster to be
 	// ready.
@@ -22,22 +64,88 @@ type LegacyFramework interface {
 }
 
 type Interface interface {
-	// Test executes the cluster state test using the configured provider
+	// Test executes the configured scenario using the configured provider
 	// implementation. The provider implementation has to be aware of the guest
-	// cluster it has to act against. The test processes the following steps to
-	// ensure the cluster state persists when rebooting and replacing the
-	// master node.
+	// cluster it has to act against. The default scenario processes the
+	// following steps to ensure the cluster state persists when rebooting and
+	// replacing the master and worker nodes.
 	//
 	//  - Install test app.
 	//  - Check test app is installed.
-	//  - Reboot master node.
-	//  - Wait for API to be down.
-	//  - Wait for cluster to be ready.
-	//  - Check test app is installed.
-	//  - Replace master node.
-	//  - Wait for API to be down.
-	//  - Wait for cluster to be ready.
-	//  - Check test app is installed.
+	//  - Write sentinel objects.
+	//  - Install stateful workload.
+	//  - Reboot master nodes.
+	//  - Wait for cluster to recover.
+	//  - Check test app is installed and sentinel objects are unchanged.
+	//  - Replace master nodes.
+	//  - Wait for cluster to recover.
+	//  - Check test app is installed and sentinel objects are unchanged.
+	//  - Check master nodes have new node names and UIDs.
+	//  - Reboot a worker node.
+	//  - Wait for cluster to recover.
+	//  - Check cluster state.
+	//  - Drain a worker node.
+	//  - Check cluster state and uncordon the drained node.
+	//  - Replace a worker node.
+	//  - Wait for cluster to recover.
+	//  - Check cluster state and worker node count.
+	//  - Partition a master from all workers, if Config.NetworkPartition is
+	//    enabled.
+	//  - Heal the partition after Config.NetworkPartition.Duration.
+	//  - Wait for all nodes to be ready and the cluster to recover.
+	//  - Check no test app or stateful workload pods got lost or duplicated
+	//    and check cluster state.
+	//  - Back up etcd, if Config.EtcdBackupRestore is set.
+	//  - Modify a sentinel object and create a new object.
+	//  - Restore etcd from the backup.
+	//  - Wait for cluster to recover.
+	//  - Check the new object is absent and check cluster state.
+	//
+	// Checking the cluster state first runs the health gate unless
+	// Config.HealthGate is disabled. It requires all nodes to be ready,
+	// CoreDNS to be available, all DaemonSets in kube-system, e.g. kube-proxy
+	// and the CNI, to be rolled out and no pods to be stuck terminating or in
+	// an unknown phase. A probe pod verifies cluster DNS and service routing.
+	// The health of every component is available using Result. Afterwards the
+	// test app pods must be ready on schedulable nodes, the stateful workload
+	// pod must be ready using its original persistent volume claim, the
+	// checksums of the dataset stored in its volume must be intact and
+	// sentinel objects must be unchanged.
+	//
+	// Sentinel objects are a namespace with annotations, config maps and a
+	// secret with random content and a custom resource. Their UIDs, resource
+	// versions and content must not change, which would for instance happen
+	// when etcd got restored from an old snapshot.
+	//
+	// Single master clusters are expected to lose their API while the master
+	// is disrupted. The masters of HA clusters are disrupted one at a time by
+	// default, in which case the API is expected to stay available.
+	//
+	// The API is probed continuously during every master and worker
+	// disruption. The downtime windows and the time until the tenant cluster
+	// is ready again are available using Result after the test. Disruptions
+	// taking longer than Config.MaxRecoveryTime to recover fail the test.
+	//
+	// Every disruption must leave evidence within
+	// Config.DisruptionEvidenceTimeout, e.g. observed API downtime, a new
+	// node boot ID, a kubelet restart or an API server pod restart. This way
+	// masters rebooting faster than the API is polled do not make the test
+	// wait for downtime which already happened.
+	//
+	// The test app defaults to the e2e-app-chart from quay.io and can be
+	// replaced using Config.TestApp, e.g. to install it from a mirror.
+	//
+	// Custom scenarios are composed from the steps returned by functions like
+	// RebootMasters and ReplaceMasters, or custom steps, and configured using
+	// Config.Scenario.
+	//
+	// The test app, the sentinel objects and the stateful workload are
+	// deleted after the scenario, also when it failed, unless
+	// Config.KeepResources is set. A test app release left behind by an
+	// earlier run is upgraded instead of installed.
 	//
 	Test(ctx context.Context) error
+	// Result returns the API downtime windows and recovery times measured
+	// during the last test run.
+	Result() Result
 }
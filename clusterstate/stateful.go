@@ -0,0 +1,414 @@
+package clusterstate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	statefulWorkloadDatasetDir      = "dataset"
+	statefulWorkloadDatasetFileSize = 4096
+	statefulWorkloadImage           = "quay.io/giantswarm/busybox:1.32.0"
+	statefulWorkloadName            = "e2e-stateful"
+	statefulWorkloadNamespace       = "e2e-stateful"
+	statefulWorkloadPort            = 8080
+	statefulWorkloadSelector        = "app=e2e-stateful"
+)
+
+// statefulWorkloadDatasetLostExitCode is the exit code of the init container
+// when it finds an empty volume after the dataset config map got deleted,
+// which means the volume got lost.
+const statefulWorkloadDatasetLostExitCode = 3
+
+var (
+	statefulWorkloadPod = fmt.Sprintf("%s-0", statefulWorkloadName)
+	statefulWorkloadPVC = fmt.Sprintf("data-%s-0", statefulWorkloadName)
+)
+
+// statefulWorkload is the state of the stateful workload which must survive
+// all disruptions.
+type statefulWorkload struct {
+	pvcUID types.UID
+	// checksums are the SHA256 checksums of the dataset files indexed by
+	// file name.
+	checksums map[string]string
+}
+
+// installStatefulWorkload creates a single replica stateful set with a
+// persistent volume claim in the tenant cluster. An init container copies a
+// random dataset from a config map into the persistent volume on first start.
+// The config map is deleted once the dataset is verified, so that later pods
+// cannot copy it again. The init container of a later pod fails if it finds
+// an empty volume, which waitForStatefulWorkload reports as dataset mismatch.
+// The workload container serves the volume via HTTP, so that the dataset can
+// be read back and verified after every disruption. Since the dataset is only
+// copied on first start, intact checksums prove that the volume survived.
+func (c *ClusterState) installStatefulWorkload(ctx context.Context) (statefulWorkload, error) {
+	dataset, checksums := newDataset(c.statefulWorkload.DatasetFiles)
+
+	{
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: statefulWorkloadNamespace,
+				Labels: map[string]string{
+					managedByLabel: managedByValue,
+				},
+			},
+		}
+
+		_, err := c.k8sClient.K8sClient().CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Fall through.
+		} else if err != nil {
+			return statefulWorkload{}, microerror.Mask(err)
+		}
+	}
+
+	{
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      statefulWorkloadName,
+				Namespace: statefulWorkloadNamespace,
+			},
+			Data: dataset,
+		}
+
+		_, err := c.k8sClient.K8sClient().CoreV1().ConfigMaps(statefulWorkloadNamespace).Create(ctx, cm, metav1.CreateOptions{})
+		if err != nil {
+			return statefulWorkload{}, microerror.Mask(err)
+		}
+	}
+
+	{
+		replicas := int32(1)
+		labels := map[string]string{
+			"app": statefulWorkloadName,
+		}
+
+		var storageClassName *string
+		if c.statefulWorkload.StorageClass != "" {
+			storageClassName = &c.statefulWorkload.StorageClass
+		}
+
+		optional := true
+
+		ss := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      statefulWorkloadName,
+				Namespace: statefulWorkloadNamespace,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: labels,
+				},
+				ServiceName: statefulWorkloadName,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: labels,
+					},
+					Spec: corev1.PodSpec{
+						InitContainers: []corev1.Container{
+							{
+								Name:    "copy-dataset",
+								Image:   statefulWorkloadImage,
+								Command: []string{"sh", "-c", copyDatasetScript("/data", "/"+statefulWorkloadDatasetDir)},
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "data",
+										MountPath: "/data",
+									},
+									{
+										Name:      statefulWorkloadDatasetDir,
+										MountPath: "/" + statefulWorkloadDatasetDir,
+									},
+								},
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name:  statefulWorkloadName,
+								Image: statefulWorkloadImage,
+								Command: []string{
+									"httpd", "-f", "-p", fmt.Sprintf("%d", statefulWorkloadPort), "-h", "/data",
+								},
+								Ports: []corev1.ContainerPort{
+									{
+										Name:          "http",
+										ContainerPort: statefulWorkloadPort,
+									},
+								},
+								ReadinessProbe: &corev1.Probe{
+									Handler: corev1.Handler{
+										HTTPGet: &corev1.HTTPGetAction{
+											Path: fmt.Sprintf("/%s/.complete", statefulWorkloadDatasetDir),
+											Port: intstr.FromInt(statefulWorkloadPort),
+										},
+									},
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "data",
+										MountPath: "/data",
+									},
+								},
+							},
+						},
+						Volumes: []corev1.Volume{
+							{
+								Name: statefulWorkloadDatasetDir,
+								VolumeSource: corev1.VolumeSource{
+									ConfigMap: &corev1.ConfigMapVolumeSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: statefulWorkloadName,
+										},
+										// The config map is deleted after
+										// the first copy.
+										Optional: &optional,
+									},
+								},
+							},
+						},
+					},
+				},
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "data",
+						},
+						Spec: corev1.PersistentVolumeClaimSpec{
+							AccessModes: []corev1.PersistentVolumeAccessMode{
+								corev1.ReadWriteOnce,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceStorage: resource.MustParse("1Gi"),
+								},
+							},
+							StorageClassName: storageClassName,
+						},
+					},
+				},
+			},
+		}
+
+		_, err := c.k8sClient.K8sClient().AppsV1().StatefulSets(statefulWorkloadNamespace).Create(ctx, ss, metav1.CreateOptions{})
+		if err != nil {
+			return statefulWorkload{}, microerror.Mask(err)
+		}
+	}
+
+	pvcUID, err := c.waitForStatefulWorkload(ctx, "")
+	if err != nil {
+		return statefulWorkload{}, microerror.Mask(err)
+	}
+
+	w := statefulWorkload{
+		pvcUID:    pvcUID,
+		checksums: checksums,
+	}
+
+	err = c.verifyDataset(ctx, w.checksums)
+	if err != nil {
+		return statefulWorkload{}, microerror.Mask(err)
+	}
+
+	{
+		err = c.k8sClient.K8sClient().CoreV1().ConfigMaps(statefulWorkloadNamespace).Delete(ctx, statefulWorkloadName, metav1.DeleteOptions{})
+		if err != nil {
+			return statefulWorkload{}, microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleted dataset config map %#q", statefulWorkloadName))
+	}
+
+	return w, nil
+}
+
+// copyDatasetScript returns the init container script copying the dataset
+// from the given config map directory into the given volume directory, unless
+// the volume already holds the complete dataset. Once the config map is gone
+// an empty volume cannot be filled again, so the script exits with
+// statefulWorkloadDatasetLostExitCode instead.
+func copyDatasetScript(volumeDir, configMapDir string) string {
+	dataDir := fmt.Sprintf("%s/%s", volumeDir, statefulWorkloadDatasetDir)
+
+	return fmt.Sprintf(
+		"if [ -f %[1]s/.complete ]; then exit 0; fi; "+
+			"if [ ! -f %[2]s/SHA256SUMS ]; then echo 'dataset is missing from the volume'; exit %[3]d; fi; "+
+			"mkdir -p %[1]s && cp %[2]s/* %[1]s/ && touch %[1]s/.complete",
+		dataDir, configMapDir, statefulWorkloadDatasetLostExitCode,
+	)
+}
+
+// checkStatefulWorkload waits for the stateful workload pod to be ready on a
+// schedulable node using the original persistent volume claim and verifies
+// the checksums of the dataset stored in the volume.
+func (c *ClusterState) checkStatefulWorkload(ctx context.Context, w statefulWorkload) error {
+	_, err := c.waitForStatefulWorkload(ctx, w.pvcUID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = c.verifyDataset(ctx, w.checksums)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *ClusterState) waitForStatefulWorkload(ctx context.Context, pvcUID types.UID) (types.UID, error) {
+	var uid types.UID
+
+	o := func() error {
+		pvc, err := c.k8sClient.K8sClient().CoreV1().PersistentVolumeClaims(statefulWorkloadNamespace).Get(ctx, statefulWorkloadPVC, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return microerror.Maskf(waitError, "persistent volume claim %#q does not exist", statefulWorkloadPVC)
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+		if pvcUID != "" && pvc.UID != pvcUID {
+			return backoff.Permanent(microerror.Maskf(statefulWorkloadError, "persistent volume claim %#q has UID %#q, want %#q", pvc.Name, pvc.UID, pvcUID))
+		}
+		if pvc.Status.Phase != corev1.ClaimBound {
+			return microerror.Maskf(waitError, "persistent volume claim %#q is %#q", pvc.Name, pvc.Status.Phase)
+		}
+
+		pod, err := c.k8sClient.K8sClient().CoreV1().Pods(statefulWorkloadNamespace).Get(ctx, statefulWorkloadPod, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Fall through.
+		} else if err != nil {
+			return microerror.Mask(err)
+		} else if isDatasetLost(*pod) {
+			return backoff.Permanent(microerror.Maskf(datasetMismatchError, "dataset is missing from the volume of pod %#q", pod.Name))
+		}
+
+		err = c.checkPodsRescheduled(ctx, statefulWorkloadNamespace, statefulWorkloadSelector, 1)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		uid = pvc.UID
+
+		return nil
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	n := func(err error, delay time.Duration) {
+		c.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return uid, nil
+}
+
+// isDatasetLost returns whether the init container of the given stateful
+// workload pod found an empty volume, see copyDatasetScript.
+func isDatasetLost(p corev1.Pod) bool {
+	for _, s := range p.Status.InitContainerStatuses {
+		for _, t := range []*corev1.ContainerStateTerminated{s.State.Terminated, s.LastTerminationState.Terminated} {
+			if t != nil && t.ExitCode == statefulWorkloadDatasetLostExitCode {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// verifyDataset reads all dataset files from the stateful workload pod using
+// the API server pod proxy and compares their checksums with the given ones.
+func (c *ClusterState) verifyDataset(ctx context.Context, checksums map[string]string) error {
+	var names []string
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := fmt.Sprintf("%s/%s", statefulWorkloadDatasetDir, name)
+
+		b, err := c.k8sClient.K8sClient().CoreV1().RESTClient().Get().
+			Namespace(statefulWorkloadNamespace).
+			Resource("pods").
+			Name(fmt.Sprintf("%s:%d", statefulWorkloadPod, statefulWorkloadPort)).
+			SubResource("proxy").
+			Suffix(path).
+			DoRaw(ctx)
+		if apierrors.IsNotFound(err) {
+			return microerror.Maskf(datasetMismatchError, "dataset file %#q does not exist", name)
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		if checksum(b) != checksums[name] {
+			return microerror.Maskf(datasetMismatchError, "dataset file %#q has checksum %#q, want %#q", name, checksum(b), checksums[name])
+		}
+	}
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("verified checksums of %d dataset files", len(names)))
+
+	return nil
+}
+
+// deleteStatefulWorkload deletes the stateful workload namespace including
+// the stateful set and its persistent volume claim, if the namespace was
+// created by the test, and waits for it to be gone.
+func (c *ClusterState) deleteStatefulWorkload(ctx context.Context) error {
+	err := c.deleteManagedNamespace(ctx, statefulWorkloadNamespace)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// newDataset returns the given number of files with random content indexed
+// by file name and their checksums. The dataset also contains a SHA256SUMS
+// file listing the checksums for debugging.
+func newDataset(files int) (map[string]string, map[string]string) {
+	dataset := map[string]string{}
+	checksums := map[string]string{}
+
+	var sums []string
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("file-%03d", i)
+		content := rand.String(statefulWorkloadDatasetFileSize)
+
+		dataset[name] = content
+		checksums[name] = checksum([]byte(content))
+		sums = append(sums, fmt.Sprintf("%s  %s", checksums[name], name))
+	}
+
+	sumsContent := strings.Join(sums, "\n") + "\n"
+	dataset["SHA256SUMS"] = sumsContent
+	checksums["SHA256SUMS"] = checksum([]byte(sumsContent))
+
+	return dataset, checksums
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,292 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/k8sclient/v4/pkg/k8sclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/giantswarm/e2etests/v2/clusterstate/provider/providertest"
+)
+
+func Test_ClusterState_verifyDataset(t *testing.T) {
+	testCases := []struct {
+		name         string
+		modify       func(dataset map[string]string)
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: dataset is intact",
+			modify:       func(dataset map[string]string) {},
+			errorMatcher: nil,
+		},
+		{
+			name: "case 1: dataset file changed",
+			modify: func(dataset map[string]string) {
+				dataset["file-001"] = "corrupted"
+			},
+			errorMatcher: IsDatasetMismatch,
+		},
+		{
+			name: "case 2: dataset file lost",
+			modify: func(dataset map[string]string) {
+				delete(dataset, "file-002")
+			},
+			errorMatcher: IsDatasetMismatch,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			dataset, checksums := newDataset(4)
+			tc.modify(dataset)
+
+			prefix := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:%d/proxy/%s/", statefulWorkloadNamespace, statefulWorkloadPod, statefulWorkloadPort, statefulWorkloadDatasetDir)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content, ok := dataset[strings.TrimPrefix(r.URL.Path, prefix)]
+				if !strings.HasPrefix(r.URL.Path, prefix) || !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(content))
+			}))
+			defer server.Close()
+
+			k8sClient, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			c, err := New(Config{
+				K8sClient: k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				Logger:    microloggertest.New(),
+				Provider:  providertest.New(providertest.Config{}),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.verifyDataset(context.Background(), checksums)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+		})
+	}
+}
+
+func Test_newDataset(t *testing.T) {
+	dataset, checksums := newDataset(3)
+
+	// Three files plus SHA256SUMS.
+	if len(dataset) != 4 {
+		t.Fatalf("files == %d, want %d", len(dataset), 4)
+	}
+
+	for name, content := range dataset {
+		if checksum([]byte(content)) != checksums[name] {
+			t.Fatalf("checksum of %#q == %#q, want %#q", name, checksums[name], checksum([]byte(content)))
+		}
+		if name != "SHA256SUMS" && !strings.Contains(dataset["SHA256SUMS"], checksums[name]+"  "+name) {
+			t.Fatalf("SHA256SUMS does not list %#q", name)
+		}
+	}
+}
+
+func Test_copyDatasetScript(t *testing.T) {
+	testCases := []struct {
+		name string
+		// configMap is whether the dataset config map is mounted.
+		configMap bool
+		// volume is whether the volume already holds the complete dataset.
+		volume           bool
+		expectedExitCode int
+		expectedCopied   bool
+	}{
+		{
+			name:             "case 0: first start copies the dataset into the empty volume",
+			configMap:        true,
+			volume:           false,
+			expectedExitCode: 0,
+			expectedCopied:   true,
+		},
+		{
+			name:             "case 1: restart keeps the dataset in the volume",
+			configMap:        false,
+			volume:           true,
+			expectedExitCode: 0,
+			expectedCopied:   true,
+		},
+		{
+			name:             "case 2: restart with an empty volume fails",
+			configMap:        false,
+			volume:           false,
+			expectedExitCode: statefulWorkloadDatasetLostExitCode,
+			expectedCopied:   false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "stateful")
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			volumeDir := filepath.Join(dir, "data")
+			configMapDir := filepath.Join(dir, statefulWorkloadDatasetDir)
+			dataset, _ := newDataset(2)
+
+			for _, d := range []string{volumeDir, configMapDir} {
+				err = os.MkdirAll(d, 0755)
+				if err != nil {
+					t.Fatalf("unexpected error %#v", err)
+				}
+			}
+			if tc.configMap {
+				for name, content := range dataset {
+					err = ioutil.WriteFile(filepath.Join(configMapDir, name), []byte(content), 0644)
+					if err != nil {
+						t.Fatalf("unexpected error %#v", err)
+					}
+				}
+			}
+			if tc.volume {
+				dataDir := filepath.Join(volumeDir, statefulWorkloadDatasetDir)
+				err = os.MkdirAll(dataDir, 0755)
+				if err != nil {
+					t.Fatalf("unexpected error %#v", err)
+				}
+				for _, name := range []string{"SHA256SUMS", ".complete"} {
+					err = ioutil.WriteFile(filepath.Join(dataDir, name), []byte(dataset[name]), 0644)
+					if err != nil {
+						t.Fatalf("unexpected error %#v", err)
+					}
+				}
+			}
+
+			err = exec.Command("sh", "-c", copyDatasetScript(volumeDir, configMapDir)).Run()
+
+			var exitCode int
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+			if exitCode != tc.expectedExitCode {
+				t.Fatalf("%s: exit code == %d, want %d", tc.name, exitCode, tc.expectedExitCode)
+			}
+
+			b, err := ioutil.ReadFile(filepath.Join(volumeDir, statefulWorkloadDatasetDir, "SHA256SUMS"))
+			copied := err == nil && string(b) == dataset["SHA256SUMS"]
+			if copied != tc.expectedCopied {
+				t.Fatalf("%s: copied == %t, want %t", tc.name, copied, tc.expectedCopied)
+			}
+		})
+	}
+}
+
+func Test_ClusterState_waitForStatefulWorkload(t *testing.T) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      statefulWorkloadPVC,
+			Namespace: statefulWorkloadNamespace,
+			UID:       "pvc-1",
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase: corev1.ClaimBound,
+		},
+	}
+	pod := func(initStatus corev1.ContainerStatus, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      statefulWorkloadPod,
+				Namespace: statefulWorkloadNamespace,
+				Labels:    map[string]string{"app": statefulWorkloadName},
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: ready},
+				},
+				InitContainerStatuses: []corev1.ContainerStatus{initStatus},
+			},
+		}
+	}
+	terminated := func(exitCode int32) *corev1.ContainerStateTerminated {
+		return &corev1.ContainerStateTerminated{ExitCode: exitCode}
+	}
+
+	testCases := []struct {
+		name         string
+		pod          *corev1.Pod
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: dataset copied and pod ready",
+			pod:          pod(corev1.ContainerStatus{Name: "copy-dataset", State: corev1.ContainerState{Terminated: terminated(0)}}, corev1.ConditionTrue),
+			errorMatcher: nil,
+		},
+		{
+			name:         "case 1: restart found an empty volume",
+			pod:          pod(corev1.ContainerStatus{Name: "copy-dataset", State: corev1.ContainerState{Terminated: terminated(statefulWorkloadDatasetLostExitCode)}}, corev1.ConditionFalse),
+			errorMatcher: IsDatasetMismatch,
+		},
+		{
+			name: "case 2: init container is restarted after finding an empty volume",
+			pod: pod(corev1.ContainerStatus{
+				Name:                 "copy-dataset",
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: terminated(statefulWorkloadDatasetLostExitCode)},
+			}, corev1.ConditionFalse),
+			errorMatcher: IsDatasetMismatch,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(pvc.DeepCopy(), tc.pod)
+
+			c, err := New(Config{
+				K8sClient: k8sclienttest.NewClients(k8sclienttest.ClientsConfig{K8sClient: k8sClient}),
+				Logger:    microloggertest.New(),
+				Provider:  providertest.New(providertest.Config{}),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			_, err = c.waitForStatefulWorkload(context.Background(), pvc.UID)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+		})
+	}
+}
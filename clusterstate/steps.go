@@ -0,0 +1,392 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/giantswarm/microerror"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// InstallTestApp returns a step installing the e2e-app, which is deleted after
+// the scenario.
+func InstallTestApp() Step {
+	return Step{
+		Name: "install test app",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			state.AddCleanup(c.DeleteTestApp)
+
+			err := c.InstallTestApp(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			state.testAppInstalled = true
+
+			return nil
+		},
+	}
+}
+
+// CheckTestApp returns a step checking the e2e-app is installed.
+func CheckTestApp() Step {
+	return Step{
+		Name: "check test app",
+		Kind: StepKindAssert,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			err := c.CheckTestAppIsInstalled(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// WriteSentinels returns a step writing sentinel objects, which are verified
+// by all later cluster state checks and deleted after the scenario.
+func WriteSentinels() Step {
+	return Step{
+		Name: "write sentinels",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			state.AddCleanup(c.deleteSentinels)
+
+			sentinels, err := c.writeSentinels(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("wrote %d sentinel objects", len(sentinels)))
+
+			state.sentinels = sentinels
+
+			return nil
+		},
+	}
+}
+
+// InstallStatefulWorkload returns a step installing the stateful workload,
+// which is checked by all later cluster state checks and deleted after the
+// scenario.
+func InstallStatefulWorkload() Step {
+	return Step{
+		Name: "install stateful workload",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			state.AddCleanup(c.deleteStatefulWorkload)
+
+			w, err := c.installStatefulWorkload(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			state.statefulWorkload = &w
+
+			return nil
+		},
+	}
+}
+
+// WaitForGuestReady returns a step waiting for the tenant cluster to be
+// ready.
+func WaitForGuestReady() Step {
+	return Step{
+		Name: "wait for guest cluster",
+		Kind: StepKindWait,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			err := c.legacyFramework.WaitForGuestReady(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// CheckClusterState returns a step checking the cluster state. See
+// Interface.Test for details.
+func CheckClusterState() Step {
+	return Step{
+		Name: "check cluster state",
+		Kind: StepKindAssert,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			err := c.checkClusterState(ctx, state)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// RebootMasters returns a step rebooting all masters, waiting for the cluster
+// to recover and checking the cluster state.
+func RebootMasters() Step {
+	return Step{
+		Name: "reboot masters",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			masters, err := c.findMasters(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			err = c.disruptMasters(ctx, state, masters, "rebooting", c.provider.RebootMaster)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// ReplaceMasters returns a step replacing all masters, waiting for the
+// cluster to recover, checking the cluster state and verifying the master
+// nodes got new node names and UIDs.
+func ReplaceMasters() Step {
+	return Step{
+		Name: "replace masters",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			masters, err := c.findMasters(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			var masterNodes map[string]types.UID
+			{
+				masterNodes, err = c.findMasterNodes(ctx)
+				if err != nil {
+					return microerror.Mask(err)
+				}
+
+				c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("found %d master nodes", len(masterNodes)))
+			}
+
+			err = c.disruptMasters(ctx, state, masters, "replacing", c.provider.ReplaceMaster)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			{
+				c.logger.LogCtx(ctx, "level", "debug", "message", "verifying master nodes have been replaced")
+
+				err = c.verifyMastersReplaced(ctx, masterNodes)
+				if err != nil {
+					return microerror.Mask(err)
+				}
+
+				c.logger.LogCtx(ctx, "level", "debug", "message", "verified master nodes have been replaced")
+			}
+
+			return nil
+		},
+	}
+}
+
+// RebootWorker returns a step rebooting the first worker, waiting for the
+// worker nodes to be ready and checking the cluster state.
+func RebootWorker() Step {
+	return Step{
+		Name: "reboot worker",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			workers, workerNodes, err := c.findWorkers(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			err = c.disruptWorker(ctx, state, workers[0], len(workerNodes), "rebooting", c.provider.RebootWorker)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// DrainWorker returns a step draining the first worker, checking the cluster
+// state and uncordoning the drained worker node.
+func DrainWorker() Step {
+	return Step{
+		Name: "drain worker",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			workers, _, err := c.findWorkers(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			err = c.drainWorker(ctx, workers[0], state.check(c))
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// ReplaceWorker returns a step replacing the first worker, waiting for the
+// worker nodes to be ready, checking the cluster state and verifying the
+// worker node count got restored.
+func ReplaceWorker() Step {
+	return Step{
+		Name: "replace worker",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			workers, workerNodes, err := c.findWorkers(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			err = c.disruptWorker(ctx, state, workers[0], len(workerNodes), "replacing", c.provider.ReplaceWorker)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			{
+				c.logger.LogCtx(ctx, "level", "debug", "message", "verifying worker node count")
+
+				err = c.verifyWorkerCount(ctx, len(workerNodes))
+				if err != nil {
+					return microerror.Mask(err)
+				}
+
+				c.logger.LogCtx(ctx, "level", "debug", "message", "verified worker node count")
+			}
+
+			return nil
+		},
+	}
+}
+
+// PartitionMaster returns a step isolating the first master from all workers
+// until the partition expires after the configured duration, waiting for the
+// cluster to recover and checking no pods got lost or duplicated. The
+// provider must support network partitions.
+func PartitionMaster() Step {
+	return Step{
+		Name: "partition master",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			masters, err := c.findMasters(ctx)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			err = c.partitionMaster(ctx, state, masters[0])
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// BackupAndRestoreEtcd returns a step backing up etcd, mutating the cluster
+// state, restoring the backup and checking the cluster state matches the
+// backup point. The provider must support restoring etcd backups.
+func BackupAndRestoreEtcd() Step {
+	return Step{
+		Name: "back up and restore etcd",
+		Kind: StepKindAction,
+		Run: func(ctx context.Context, c *ClusterState, state *State) error {
+			err := c.backupAndRestoreEtcd(ctx, state.check(c))
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// check returns the cluster state check run after every recovery.
+func (s *State) check(c *ClusterState) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return c.checkClusterState(ctx, s)
+	}
+}
+
+// checkClusterState checks everything earlier steps set up: the test app pods
+// are ready on schedulable nodes, the stateful workload pod is ready using its
+// original persistent volume claim holding the intact dataset and the sentinel
+// objects are unchanged.
+func (c *ClusterState) checkClusterState(ctx context.Context, state *State) error {
+	if !c.healthGate.Disabled {
+		err := c.runHealthGate(ctx, state)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	if state.testAppInstalled {
+		err := c.CheckTestAppIsInstalled(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = c.waitForPodsRescheduled(ctx, c.testApp.Namespace, c.testApp.PodLabelSelector, c.testApp.PodCount)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	if state.statefulWorkload != nil {
+		err := c.checkStatefulWorkload(ctx, *state.statefulWorkload)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	if len(state.sentinels) > 0 {
+		err := c.verifySentinels(ctx, state.sentinels)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+func (c *ClusterState) findMasters(ctx context.Context) ([]string, error) {
+	masters, err := c.provider.Masters(ctx)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if len(masters) == 0 {
+		return nil, microerror.Maskf(notFoundError, "masters")
+	}
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("found %d masters", len(masters)))
+
+	return masters, nil
+}
+
+func (c *ClusterState) findWorkers(ctx context.Context) ([]string, map[string]types.UID, error) {
+	workers, err := c.provider.Workers(ctx)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+	if len(workers) == 0 {
+		return nil, nil, microerror.Maskf(notFoundError, "workers")
+	}
+
+	workerNodes, err := c.findWorkerNodes(ctx)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
+	c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("found %d workers and %d worker nodes", len(workers), len(workerNodes)))
+
+	return workers, workerNodes, nil
+}
@@ -0,0 +1,267 @@
+package clusterstate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// disruptWorker applies the given disruption to the worker identified by the
+// given ID, waits for the given number of worker nodes to be ready again and
+// checks the cluster state. The result of the disruption is added to the
+// given state.
+func (c *ClusterState) disruptWorker(ctx context.Context, state *State, id string, num int, action string, disrupt func(ctx context.Context, id string) error) error {
+	nodes, err := c.nodeNames(ctx, []string{id}, c.provider.WorkerNodeName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	before, err := c.collectEvidence(ctx, workerNodeLabelSelector)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	d := c.startDisruption(ctx, fmt.Sprintf("%s worker", action), id)
+	defer d.ready()
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("%s worker %#q", action, id))
+
+		err = disrupt(ctx, id)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "waiting for evidence of the worker disruption")
+
+		err = c.waitForDisruptionEvidence(ctx, d, workerNodeLabelSelector, nodes, before, false)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "worker node is disrupted")
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for %d worker nodes to be ready", num))
+
+		err = c.waitForNodesReady(ctx, workerNodeLabelSelector, num)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("%d worker nodes are ready", num))
+	}
+
+	err = c.recordDisruption(ctx, state, d.ready())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking cluster state")
+
+		err = c.checkClusterState(ctx, state)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cluster state is intact")
+	}
+
+	return nil
+}
+
+// drainWorker drains the worker identified by the given ID, runs the given
+// check and uncordons all worker nodes which got cordoned by the drain.
+func (c *ClusterState) drainWorker(ctx context.Context, id string, check func(ctx context.Context) error) error {
+	var err error
+
+	var cordoned map[string]bool
+	{
+		cordoned, err = c.findUnschedulableNodes(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	defer func() {
+		c.logger.LogCtx(ctx, "level", "debug", "message", "uncordoning drained worker nodes")
+
+		err := c.uncordonNodes(ctx, cordoned)
+		if err != nil {
+			c.logger.LogCtx(ctx, "level", "error", "message", "failed to uncordon drained worker nodes", "stack", fmt.Sprintf("%#v", err))
+			return
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "uncordoned drained worker nodes")
+	}()
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("draining worker %#q", id))
+
+		err = c.provider.DrainWorker(ctx, id)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("drained worker %#q", id))
+	}
+
+	{
+		c.logger.LogCtx(ctx, "level", "debug", "message", "checking cluster state")
+
+		err = check(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		c.logger.LogCtx(ctx, "level", "debug", "message", "cluster state is intact")
+	}
+
+	return nil
+}
+
+// findWorkerNodes returns the UIDs of the tenant cluster worker nodes indexed
+// by node name.
+func (c *ClusterState) findWorkerNodes(ctx context.Context) (map[string]types.UID, error) {
+	nodes, err := c.findNodes(ctx, workerNodeLabelSelector)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if len(nodes) == 0 {
+		return nil, microerror.Maskf(notFoundError, "worker nodes")
+	}
+
+	return nodes, nil
+}
+
+// verifyWorkerCount ensures that the tenant cluster has the given number of
+// worker nodes, so that no disrupted worker is left behind or missing.
+func (c *ClusterState) verifyWorkerCount(ctx context.Context, num int) error {
+	nodes, err := c.findWorkerNodes(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if len(nodes) != num {
+		return microerror.Maskf(workerCountMismatchError, "want %d worker nodes found %d", num, len(nodes))
+	}
+
+	return nil
+}
+
+// checkPodsRescheduled ensures that the given number of pods matching the
+// given label selector are ready and none of them runs on an unschedulable
+// node.
+func (c *ClusterState) checkPodsRescheduled(ctx context.Context, namespace, selector string, num int) error {
+	unschedulable, err := c.findUnschedulableNodes(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	lo := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	l, err := c.k8sClient.K8sClient().CoreV1().Pods(namespace).List(ctx, lo)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	var ready int
+	for _, p := range l.Items {
+		if p.DeletionTimestamp != nil || !isPodReady(p) {
+			continue
+		}
+		if unschedulable[p.Spec.NodeName] {
+			return microerror.Maskf(waitError, "pod %#q still runs on unschedulable node %#q", p.Name, p.Spec.NodeName)
+		}
+		ready++
+	}
+
+	if ready != num {
+		return microerror.Maskf(waitError, "want %d ready pods matching %#q found %d", num, selector, ready)
+	}
+
+	return nil
+}
+
+// waitForPodsRescheduled waits for checkPodsRescheduled to succeed.
+func (c *ClusterState) waitForPodsRescheduled(ctx context.Context, namespace, selector string, num int) error {
+	o := func() error {
+		err := c.checkPodsRescheduled(ctx, namespace, selector, num)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+
+	b := backoff.NewConstant(backoff.MediumMaxWait, backoff.ShortMaxInterval)
+	n := func(err error, delay time.Duration) {
+		c.logger.Log("level", "debug", "message", err.Error())
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *ClusterState) findUnschedulableNodes(ctx context.Context) (map[string]bool, error) {
+	l, err := c.k8sClient.K8sClient().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	nodes := map[string]bool{}
+	for _, n := range l.Items {
+		if n.Spec.Unschedulable {
+			nodes[n.Name] = true
+		}
+	}
+
+	return nodes, nil
+}
+
+// uncordonNodes marks all unschedulable nodes schedulable again, except the
+// given nodes which were already unschedulable before.
+func (c *ClusterState) uncordonNodes(ctx context.Context, keep map[string]bool) error {
+	unschedulable, err := c.findUnschedulableNodes(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	for name := range unschedulable {
+		if keep[name] {
+			continue
+		}
+
+		patch := []byte(`{"spec":{"unschedulable":false}}`)
+		_, err = c.k8sClient.K8sClient().CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+func isPodReady(p corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -3,6 +3,11 @@ module github.com/giantswarm/e2etests/v2
 go 1.14
 
 require (
+	github.com/Azure/azure-sdk-for-go v46.0.0+incompatible
+	github.com/Azure/go-autorest/autorest v0.11.4
+	github.com/Azure/go-autorest/autorest/to v0.4.1
+	github.com/Azure/go-autorest/autorest/validation v0.3.1 // indirect
+	github.com/aws/aws-sdk-go v1.34.28
 	github.com/giantswarm/apiextensions/v2 v2.0.0
 	github.com/giantswarm/apprclient/v2 v2.0.0
 	github.com/giantswarm/backoff v0.2.0
@@ -12,7 +17,9 @@ require (
 	github.com/giantswarm/microerror v0.2.1
 	github.com/giantswarm/micrologger v0.3.1
 	github.com/spf13/afero v1.3.4
+	helm.sh/helm/v3 v3.2.4
 	k8s.io/api v0.18.5
+	k8s.io/apiextensions-apiserver v0.18.5
 	k8s.io/apimachinery v0.18.5
 	k8s.io/client-go v0.18.5
 	sigs.k8s.io/yaml v1.2.0
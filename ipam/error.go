@@ -20,6 +20,15 @@ func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
 
+var invalidSubnetError = &microerror.Error{
+	Kind: "invalidSubnetError",
+}
+
+// IsInvalidSubnet asserts invalidSubnetError.
+func IsInvalidSubnet(err error) bool {
+	return microerror.Cause(err) == invalidSubnetError
+}
+
 var subnetsOverlapError = &microerror.Error{
 	Kind: "subnetsOverlap",
 }
@@ -28,3 +37,12 @@ var subnetsOverlapError = &microerror.Error{
 func IsSubnetsOverlap(err error) bool {
 	return microerror.Cause(err) == subnetsOverlapError
 }
+
+var subnetReusedError = &microerror.Error{
+	Kind: "subnetReusedError",
+}
+
+// IsSubnetReused asserts subnetReusedError.
+func IsSubnetReused(err error) bool {
+	return microerror.Cause(err) == subnetReusedError
+}
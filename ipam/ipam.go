@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/giantswarm/ipam"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
+	"k8s.io/apimachinery/pkg/util/rand"
 
 	"github.com/giantswarm/e2etests/v2/ipam/provider"
 )
@@ -16,14 +20,51 @@ type Config struct {
 	Logger   micrologger.Logger
 	Provider provider.Interface
 
-	ClusterID string
+	// ChurnRounds is the number of rounds in which random tenant clusters are
+	// deleted and replaced by new tenant clusters. Defaults to 1.
+	ChurnRounds int
+	// ChurnSize is the number of tenant clusters replaced in every churn round.
+	// It must not exceed ClusterCount. Defaults to 1.
+	ChurnSize int
+	// ClusterCount is the number of tenant clusters existing at any time of
+	// the test. Defaults to 3.
+	ClusterCount int
+	ClusterID    string
+	// NetworkRange is the tenant network range of the installation in CIDR
+	// notation. All allocated subnets must lie within it. Allocated subnets
+	// are not checked against the network range if it is empty.
+	NetworkRange string
+	// ReservedRanges are ranges in CIDR notation which no allocated subnet may
+	// overlap with, e.g. the docker bridge or the service CIDR.
+	ReservedRanges []string
+	// SubnetSize is the expected mask size of allocated subnets, e.g. 24 for
+	// /24 subnets. The mask size is not checked if it is 0.
+	SubnetSize int
+	// ConcurrentCreation creates tenant clusters concurrently instead of one
+	// after another. All creations are released at the same time, so that
+	// races in the subnet allocation of the operator show up as duplicate or
+	// overlapping subnets.
+	ConcurrentCreation bool
+	// QuarantineRounds is the number of churn rounds, starting with the round
+	// freeing a subnet, in which the freed subnet must not be allocated again.
+	// Defaults to ChurnRounds, so that freed subnets are never reused during
+	// the test.
+	QuarantineRounds int
 }
 
 type IPAM struct {
 	logger   micrologger.Logger
 	provider provider.Interface
 
-	clusterID string
+	churnRounds        int
+	churnSize          int
+	clusterCount       int
+	clusterID          string
+	concurrentCreation bool
+	networkRange       *net.IPNet
+	quarantineRounds   int
+	reservedRanges     []*net.IPNet
+	subnetSize         int
 }
 
 func New(config Config) (*IPAM, error) {
@@ -34,45 +75,110 @@ func New(config Config) (*IPAM, error) {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Provider must not be empty", config)
 	}
 
+	if config.ChurnRounds < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ChurnRounds must not be negative", config)
+	}
+	if config.ChurnSize < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ChurnSize must not be negative", config)
+	}
+	if config.ClusterCount < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ClusterCount must not be negative", config)
+	}
 	if config.ClusterID == "" {
 		return nil, microerror.Maskf(invalidConfigError, "%T.ClusterID must not be empty", config)
 	}
+	if config.QuarantineRounds < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.QuarantineRounds must not be negative", config)
+	}
+
+	var networkRange *net.IPNet
+	if config.NetworkRange != "" {
+		_, n, err := net.ParseCIDR(config.NetworkRange)
+		if err != nil {
+			return nil, microerror.Maskf(invalidConfigError, "%T.NetworkRange must be a CIDR: %s", config, err)
+		}
+		networkRange = n
+	}
+	var reservedRanges []*net.IPNet
+	for _, r := range config.ReservedRanges {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, microerror.Maskf(invalidConfigError, "%T.ReservedRanges must be CIDRs: %s", config, err)
+		}
+		reservedRanges = append(reservedRanges, n)
+	}
+	if config.SubnetSize < 0 || config.SubnetSize > 128 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.SubnetSize must be between 0 and 128", config)
+	}
+	if networkRange != nil && config.SubnetSize != 0 {
+		ones, bits := networkRange.Mask.Size()
+		if config.SubnetSize < ones || config.SubnetSize > bits {
+			return nil, microerror.Maskf(invalidConfigError, "%T.SubnetSize must be between %d and %d for %T.NetworkRange %s", config, ones, bits, config, networkRange)
+		}
+	}
+
+	if config.ChurnRounds == 0 {
+		config.ChurnRounds = defaultChurnRounds
+	}
+	if config.ChurnSize == 0 {
+		config.ChurnSize = defaultChurnSize
+	}
+	if config.ClusterCount == 0 {
+		config.ClusterCount = defaultClusterCount
+	}
+	if config.QuarantineRounds == 0 {
+		config.QuarantineRounds = config.ChurnRounds
+	}
+
+	if config.ChurnSize > config.ClusterCount {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ChurnSize must not exceed %T.ClusterCount", config, config)
+	}
 
 	i := &IPAM{
 		logger:   config.Logger,
 		provider: config.Provider,
 
-		clusterID: config.ClusterID,
+		churnRounds:        config.ChurnRounds,
+		churnSize:          config.ChurnSize,
+		clusterCount:       config.ClusterCount,
+		clusterID:          config.ClusterID,
+		concurrentCreation: config.ConcurrentCreation,
+		networkRange:       networkRange,
+		quarantineRounds:   config.QuarantineRounds,
+		reservedRanges:     reservedRanges,
+		subnetSize:         config.SubnetSize,
 	}
 
 	return i, nil
 }
 
 func (i *IPAM) Test(ctx context.Context) error {
-	// Clusters to be created during this test.
-	var (
-		clusterOne   = i.clusterID + "-1"
-		clusterTwo   = i.clusterID + "-2"
-		clusterThree = i.clusterID + "-3"
-		clusterFour  = i.clusterID + "-4"
-	)
-
-	// Lists of clusters we work with in the test below.
-	var (
-		threeClusters = []string{clusterOne, clusterTwo, clusterThree}
-		fourClusters  = []string{clusterOne, clusterTwo, clusterThree, clusterFour}
-	)
+	// IDs of the tenant clusters which were created and not deleted yet.
+	var clusters []string
 
 	// Map of allocated subnets and tenant cluster ID pairs. The map keys are
-	// subnets. The map values are cluster IDs.
-	var (
-		allocatedSubnets = map[string]string{}
-	)
+	// cluster IDs. The map values are subnets.
+	allocatedSubnets := map[string]string{}
+
+	// Map of subnets freed by deleted tenant clusters. The map keys are
+	// subnets. The map values are the churn rounds in which the subnets were
+	// freed.
+	freedSubnets := map[string]int{}
+
+	var created int
+	newClusterIDs := func(n int) []string {
+		var ids []string
+		for j := 0; j < n; j++ {
+			created++
+			ids = append(ids, fmt.Sprintf("%s-%d", i.clusterID, created))
+		}
+		return ids
+	}
 
 	defer func() {
 		i.logger.LogCtx(ctx, "level", "debug", "message", "deleting all tenant clusters")
 
-		for _, c := range fourClusters {
+		for _, c := range clusters {
 			err := i.provider.DeleteCluster(ctx, c)
 			if err != nil {
 				i.logger.LogCtx(ctx, "level", "error", "message", fmt.Sprintf("failed to delete tenant cluster %#q", c), "stack", fmt.Sprintf("%#v", microerror.Mask(err)))
@@ -83,127 +189,309 @@ func (i *IPAM) Test(ctx context.Context) error {
 	}()
 
 	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", "creating three tenant clusters")
+		ids := newClusterIDs(i.clusterCount)
 
-		for _, c := range threeClusters {
-			err := i.provider.CreateCluster(ctx, c)
+		createdIDs, err := i.createClusters(ctx, ids)
+		clusters = append(clusters, createdIDs...)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = i.waitForClustersCreated(ctx, ids)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = i.fetchSubnets(ctx, ids, allocatedSubnets)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = i.verifySubnets(ctx, allocatedSubnets, ids, freedSubnets, 0)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	for round := 1; round <= i.churnRounds; round++ {
+		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("running churn round %d/%d", round, i.churnRounds))
+
+		var deleted []string
+		for _, j := range rand.Perm(len(clusters))[:i.churnSize] {
+			deleted = append(deleted, clusters[j])
+		}
+		sort.Strings(deleted)
+
+		for _, c := range deleted {
+			i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting tenant cluster %#q", c))
+
+			err := i.provider.DeleteCluster(ctx, c)
 			if err != nil {
 				return microerror.Mask(err)
 			}
+
+			i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleted tenant cluster %#q", c))
 		}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", "created three tenant clusters")
-	}
+		ids := newClusterIDs(i.churnSize)
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", "waiting for three tenant clusters to be created")
+		createdIDs, err := i.createClusters(ctx, ids)
+		clusters = append(clusters, createdIDs...)
+		if err != nil {
+			return microerror.Mask(err)
+		}
 
-		for _, c := range threeClusters {
-			err := i.provider.WaitForClusterCreated(ctx, c)
+		for _, c := range deleted {
+			i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for tenant cluster %#q to be deleted", c))
+
+			err := i.provider.WaitForClusterDeleted(ctx, c)
 			if err != nil {
 				return microerror.Mask(err)
 			}
+
+			clusters = removeCluster(clusters, c)
+			freedSubnets[allocatedSubnets[c]] = round
+			delete(allocatedSubnets, c)
+
+			i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waited for tenant cluster %#q to be deleted", c))
+		}
+
+		err = i.waitForClustersCreated(ctx, ids)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = i.fetchSubnets(ctx, ids, allocatedSubnets)
+		if err != nil {
+			return microerror.Mask(err)
 		}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", "waited for three tenant clusters to be created")
+		err = i.verifySubnets(ctx, allocatedSubnets, ids, freedSubnets, round)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("ran churn round %d/%d", round, i.churnRounds))
 	}
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", "verifying subnet allocations do not overlap")
+	return nil
+}
+
+// createClusters creates the given tenant clusters and returns the IDs of the
+// tenant clusters which were created successfully. If concurrent creation is
+// enabled, all tenant clusters are created from their own goroutine. A
+// barrier ensures that no creation starts before all goroutines are ready.
+func (i *IPAM) createClusters(ctx context.Context, ids []string) ([]string, error) {
+	if !i.concurrentCreation {
+		var created []string
+		for _, c := range ids {
+			i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("creating tenant cluster %#q", c))
 
-		for _, c := range threeClusters {
-			s, err := i.provider.GetClusterStatus(ctx, c)
+			err := i.provider.CreateCluster(ctx, c)
 			if err != nil {
-				return microerror.Mask(err)
+				return created, microerror.Mask(err)
 			}
+			created = append(created, c)
 
-			otherCluster, exists := allocatedSubnets[s.Network.CIDR]
-			if exists {
-				return microerror.Maskf(alreadyExistsError, "subnet %s already exists for %s", s.Network.CIDR, otherCluster)
-			}
+			i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("created tenant cluster %#q", c))
+		}
+
+		return created, nil
+	}
+
+	i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("creating %d tenant clusters concurrently", len(ids)))
+
+	var mutex sync.Mutex
+	var created []string
+	var createErr error
+
+	var ready sync.WaitGroup
+	var done sync.WaitGroup
+	start := make(chan struct{})
 
-			// Verify that allocated subnets don't overlap.
-			for subnet := range allocatedSubnets {
-				err := verifyNoOverlap(s.Network.CIDR, subnet)
-				if err != nil {
-					return microerror.Mask(err)
+	for _, c := range ids {
+		ready.Add(1)
+		done.Add(1)
+
+		go func(c string) {
+			defer done.Done()
+
+			ready.Done()
+			<-start
+
+			err := i.provider.CreateCluster(ctx, c)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				if createErr == nil {
+					createErr = err
 				}
+				return
 			}
+			created = append(created, c)
+		}(c)
+	}
 
-			allocatedSubnets[s.Network.CIDR] = c
-		}
+	ready.Wait()
+	close(start)
+	done.Wait()
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", "verified subnet allocations do not overlap")
+	if createErr != nil {
+		return created, microerror.Mask(createErr)
 	}
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleting tenant cluster %#q", clusterTwo))
+	i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("created %d tenant clusters concurrently", len(ids)))
+
+	return created, nil
+}
 
-		err := i.provider.DeleteCluster(ctx, clusterTwo)
+// fetchSubnets adds the subnets allocated to the given tenant clusters to the
+// given map of cluster IDs and subnets.
+func (i *IPAM) fetchSubnets(ctx context.Context, ids []string, allocatedSubnets map[string]string) error {
+	for _, c := range ids {
+		s, err := i.provider.GetClusterStatus(ctx, c)
 		if err != nil {
 			return microerror.Mask(err)
 		}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("deleted tenant cluster %#q", clusterTwo))
+		allocatedSubnets[c] = s.Network.CIDR
 	}
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("creating tenant cluster %#q", clusterFour))
+	return nil
+}
+
+// verifySubnets ensures the subnets of all existing tenant clusters lie within
+// the configured network range, have the configured size, do not overlap with
+// reserved ranges and are distinct and do not overlap each other. Subnets of
+// the given newly created tenant clusters must not overlap with subnets freed
+// within the quarantine window of the given churn round.
+func (i *IPAM) verifySubnets(ctx context.Context, allocatedSubnets map[string]string, created []string, freedSubnets map[string]int, round int) error {
+	i.logger.LogCtx(ctx, "level", "debug", "message", "verifying subnet allocations do not overlap")
+
+	var clusters []string
+	for c := range allocatedSubnets {
+		clusters = append(clusters, c)
+	}
+	sort.Strings(clusters)
 
-		err := i.provider.CreateCluster(ctx, clusterFour)
+	for _, c := range clusters {
+		err := i.verifyRange(c, allocatedSubnets[c])
 		if err != nil {
 			return microerror.Mask(err)
 		}
+	}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("created tenant cluster %#q", clusterFour))
+	// All conflicting pairs are reported, so that races in the subnet
+	// allocation can be told apart from a single faulty allocation.
+	var duplicates, overlaps []string
+	for j, c := range clusters {
+		for _, otherCluster := range clusters[j+1:] {
+			subnet, otherSubnet := allocatedSubnets[c], allocatedSubnets[otherCluster]
+
+			if subnet == otherSubnet {
+				duplicates = append(duplicates, fmt.Sprintf("subnet %s of %s already exists for %s", subnet, c, otherCluster))
+				continue
+			}
+
+			err := verifyNoOverlap(subnet, otherSubnet)
+			if IsSubnetsOverlap(err) {
+				overlaps = append(overlaps, fmt.Sprintf("subnet %s of %s overlaps subnet %s of %s", subnet, c, otherSubnet, otherCluster))
+			} else if err != nil {
+				return microerror.Mask(err)
+			}
+		}
 	}
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for tenant cluster %#q to be deleted", clusterTwo))
+	conflicts := append(duplicates, overlaps...)
+	for _, conflict := range conflicts {
+		i.logger.LogCtx(ctx, "level", "error", "message", conflict)
+	}
 
-		err := i.provider.WaitForClusterDeleted(ctx, clusterTwo)
-		if err != nil {
-			return microerror.Mask(err)
+	if len(duplicates) > 0 {
+		return microerror.Maskf(alreadyExistsError, "%d conflicting pairs: %s", len(conflicts), strings.Join(conflicts, ", "))
+	}
+	if len(overlaps) > 0 {
+		return microerror.Maskf(subnetsOverlapError, "%d conflicting pairs: %s", len(conflicts), strings.Join(conflicts, ", "))
+	}
+
+	for _, c := range created {
+		for subnet, freedRound := range freedSubnets {
+			if round-freedRound >= i.quarantineRounds {
+				continue
+			}
+
+			err := verifyNoOverlap(allocatedSubnets[c], subnet)
+			if IsSubnetsOverlap(err) {
+				return microerror.Maskf(subnetReusedError, "subnet %s of %s reuses subnet %s freed in churn round %d", allocatedSubnets[c], c, subnet, freedRound)
+			} else if err != nil {
+				return microerror.Mask(err)
+			}
 		}
+	}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waited for tenant cluster %#q to be deleted", clusterTwo))
+	i.logger.LogCtx(ctx, "level", "debug", "message", "verified subnet allocations do not overlap")
+
+	return nil
+}
+
+// verifyRange ensures the subnet of the given tenant cluster is a valid
+// network address within the configured network range, has the configured
+// mask size and does not overlap with any reserved range.
+func (i *IPAM) verifyRange(cluster, subnet string) error {
+	ip, n, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return microerror.Maskf(invalidSubnetError, "subnet %#q of %s is not a CIDR: %s", subnet, cluster, err)
+	}
+	if !ip.Equal(n.IP) {
+		return microerror.Maskf(invalidSubnetError, "subnet %s of %s is not a network address, want %s", subnet, cluster, n)
 	}
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for tenant cluster %#q to be created", clusterFour))
+	if i.networkRange != nil && !ipam.Contains(*i.networkRange, *n) {
+		return microerror.Maskf(invalidSubnetError, "subnet %s of %s is not within network range %s", n, cluster, i.networkRange)
+	}
 
-		err := i.provider.WaitForClusterCreated(ctx, clusterFour)
-		if err != nil {
-			return microerror.Mask(err)
+	if i.subnetSize != 0 {
+		ones, _ := n.Mask.Size()
+		if ones != i.subnetSize {
+			return microerror.Maskf(invalidSubnetError, "subnet %s of %s has mask size %d, want %d", n, cluster, ones, i.subnetSize)
 		}
+	}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waited for tenant cluster %#q to be created", clusterFour))
+	for _, r := range i.reservedRanges {
+		if ipam.Contains(*r, *n) || ipam.Contains(*n, *r) {
+			return microerror.Maskf(invalidSubnetError, "subnet %s of %s overlaps reserved range %s", n, cluster, r)
+		}
 	}
 
-	{
-		i.logger.LogCtx(ctx, "level", "debug", "message", "verifying subnet allocations do not overlap")
+	return nil
+}
+
+func (i *IPAM) waitForClustersCreated(ctx context.Context, ids []string) error {
+	i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waiting for %d tenant clusters to be created", len(ids)))
 
-		s, err := i.provider.GetClusterStatus(ctx, clusterFour)
+	for _, c := range ids {
+		err := i.provider.WaitForClusterCreated(ctx, c)
 		if err != nil {
 			return microerror.Mask(err)
 		}
+	}
 
-		otherCluster, exists := allocatedSubnets[s.Network.CIDR]
-		if exists {
-			return microerror.Maskf(alreadyExistsError, "subnet %s already exists for %s", s.Network.CIDR, otherCluster)
-		}
+	i.logger.LogCtx(ctx, "level", "debug", "message", fmt.Sprintf("waited for %d tenant clusters to be created", len(ids)))
 
-		for subnet := range allocatedSubnets {
-			err := verifyNoOverlap(s.Network.CIDR, subnet)
-			if err != nil {
-				return microerror.Mask(err)
-			}
-		}
+	return nil
+}
 
-		i.logger.LogCtx(ctx, "level", "debug", "message", "verified subnet allocations do not overlap")
+func removeCluster(clusters []string, id string) []string {
+	var remaining []string
+	for _, c := range clusters {
+		if c != id {
+			remaining = append(remaining, c)
+		}
 	}
 
-	return nil
+	return remaining
 }
 
 func verifyNoOverlap(subnet1, subnet2 string) error {
@@ -0,0 +1,466 @@
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v2/pkg/apis/provider/v1alpha1"
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+const (
+	allocateDelayed    = "delayed"
+	allocateDuplicate  = "duplicate"
+	allocateLowestFree = "lowestFree"
+	allocateRacy       = "racy"
+	allocateSequential = "sequential"
+)
+
+// providerFake allocates /24 subnets of 10.1.0.0/16 to tenant clusters using
+// the configured strategy. Tenant clusters are created and deleted
+// immediately. If barrier is set, the first tenant cluster creations fail
+// unless the given number of creations is in flight at the same time.
+type providerFake struct {
+	barrier  int
+	strategy string
+
+	mutex    sync.Mutex
+	clusters map[string]int
+	freed    []int
+	inFlight int
+	next     int
+	released chan struct{}
+}
+
+func newProviderFake(strategy string, barrier int) *providerFake {
+	return &providerFake{
+		barrier:  barrier,
+		strategy: strategy,
+
+		clusters: map[string]int{},
+		released: make(chan struct{}),
+	}
+}
+
+func (p *providerFake) CreateCluster(ctx context.Context, id string) error {
+	if p.barrier > 0 {
+		p.mutex.Lock()
+		p.inFlight++
+		if p.inFlight == p.barrier {
+			close(p.released)
+		}
+		p.mutex.Unlock()
+
+		select {
+		case <-p.released:
+		case <-time.After(time.Second):
+			return fmt.Errorf("tenant cluster %#q was not created concurrently", id)
+		}
+	}
+
+	// The racy strategy reads the next subnet before it is reserved, so
+	// that concurrently created tenant clusters get the same subnet.
+	if p.strategy == allocateRacy {
+		p.mutex.Lock()
+		subnet := p.next
+		p.mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		p.mutex.Lock()
+		p.clusters[id] = subnet
+		p.next = subnet + 1
+		p.mutex.Unlock()
+
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var subnet int
+	switch p.strategy {
+	case allocateDelayed:
+		// Freed subnets are reused once another subnet got freed after them.
+		if len(p.freed) > 1 {
+			subnet = p.freed[0]
+			p.freed = p.freed[1:]
+		} else {
+			subnet = p.next
+			p.next++
+		}
+	case allocateDuplicate:
+		subnet = 0
+	case allocateLowestFree:
+		used := map[int]bool{}
+		for _, s := range p.clusters {
+			used[s] = true
+		}
+		for used[subnet] {
+			subnet++
+		}
+	case allocateSequential:
+		subnet = p.next
+		p.next++
+	}
+
+	p.clusters[id] = subnet
+
+	return nil
+}
+
+func (p *providerFake) DeleteCluster(ctx context.Context, id string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	subnet, ok := p.clusters[id]
+	if ok {
+		p.freed = append(p.freed, subnet)
+	}
+	delete(p.clusters, id)
+	return nil
+}
+
+func (p *providerFake) GetClusterStatus(ctx context.Context, id string) (v1alpha1.StatusCluster, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	subnet, ok := p.clusters[id]
+	if !ok {
+		return v1alpha1.StatusCluster{}, fmt.Errorf("tenant cluster %#q not found", id)
+	}
+
+	s := v1alpha1.StatusCluster{
+		Network: v1alpha1.StatusClusterNetwork{
+			CIDR: fmt.Sprintf("10.1.%d.0/24", subnet),
+		},
+	}
+
+	return s, nil
+}
+
+func (p *providerFake) WaitForClusterCreated(ctx context.Context, id string) error {
+	return nil
+}
+
+func (p *providerFake) WaitForClusterDeleted(ctx context.Context, id string) error {
+	return nil
+}
+
+func Test_IPAM_Test(t *testing.T) {
+	testCases := []struct {
+		name         string
+		config       Config
+		strategy     string
+		barrier      int
+		errorMatcher func(error) bool
+	}{
+		{
+			name:     "case 0: default churn with distinct subnets",
+			strategy: allocateSequential,
+		},
+		{
+			name: "case 1: many churn rounds with distinct subnets",
+			config: Config{
+				ChurnRounds:  4,
+				ChurnSize:    2,
+				ClusterCount: 5,
+			},
+			strategy: allocateSequential,
+		},
+		{
+			name:         "case 2: freed subnet is reused",
+			strategy:     allocateLowestFree,
+			errorMatcher: IsSubnetReused,
+		},
+		{
+			name: "case 3: freed subnet is reused after quarantine",
+			config: Config{
+				ChurnRounds:      3,
+				QuarantineRounds: 1,
+			},
+			strategy: allocateDelayed,
+		},
+		{
+			name: "case 4: freed subnet is reused within quarantine",
+			config: Config{
+				ChurnRounds:      3,
+				QuarantineRounds: 2,
+			},
+			strategy:     allocateDelayed,
+			errorMatcher: IsSubnetReused,
+		},
+		{
+			name:         "case 5: duplicate subnets",
+			strategy:     allocateDuplicate,
+			errorMatcher: IsAlreadyExists,
+		},
+		{
+			name: "case 6: concurrent creation with distinct subnets",
+			config: Config{
+				ClusterCount:       5,
+				ConcurrentCreation: true,
+			},
+			strategy: allocateSequential,
+			barrier:  5,
+		},
+		{
+			name: "case 7: concurrent creation races",
+			config: Config{
+				ClusterCount:       5,
+				ConcurrentCreation: true,
+			},
+			strategy:     allocateRacy,
+			barrier:      5,
+			errorMatcher: IsAlreadyExists,
+		},
+		{
+			name: "case 8: subnets within network range",
+			config: Config{
+				NetworkRange:   "10.1.0.0/16",
+				ReservedRanges: []string{"172.17.0.0/16", "172.31.0.0/16"},
+				SubnetSize:     24,
+			},
+			strategy: allocateSequential,
+		},
+		{
+			name: "case 9: subnets outside of network range",
+			config: Config{
+				NetworkRange: "10.2.0.0/16",
+			},
+			strategy:     allocateSequential,
+			errorMatcher: IsInvalidSubnet,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			p := newProviderFake(tc.strategy, tc.barrier)
+
+			tc.config.Logger = microloggertest.New()
+			tc.config.Provider = p
+			tc.config.ClusterID = "test"
+
+			c, err := New(tc.config)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.Test(context.Background())
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if len(p.clusters) != 0 {
+				t.Fatalf("%s: %d tenant clusters left, want 0", tc.name, len(p.clusters))
+			}
+		})
+	}
+}
+
+func Test_IPAM_New(t *testing.T) {
+	testCases := []struct {
+		name         string
+		config       Config
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: defaults",
+		},
+		{
+			name: "case 1: churn size exceeds cluster count",
+			config: Config{
+				ChurnSize:    4,
+				ClusterCount: 3,
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 2: negative churn rounds",
+			config: Config{
+				ChurnRounds: -1,
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 3: invalid network range",
+			config: Config{
+				NetworkRange: "10.1.0.0",
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 4: subnet size exceeds network range",
+			config: Config{
+				NetworkRange: "10.1.0.0/16",
+				SubnetSize:   8,
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name: "case 5: invalid reserved range",
+			config: Config{
+				ReservedRanges: []string{"docker"},
+			},
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			tc.config.Logger = microloggertest.New()
+			tc.config.Provider = newProviderFake(allocateSequential, 0)
+			tc.config.ClusterID = "test"
+
+			_, err := New(tc.config)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+		})
+	}
+}
+
+func Test_IPAM_verifySubnets(t *testing.T) {
+	testCases := []struct {
+		name              string
+		config            Config
+		allocatedSubnets  map[string]string
+		expectedConflicts int
+		errorMatcher      func(error) bool
+	}{
+		{
+			name: "case 0: distinct subnets",
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.0/24",
+				"c2": "10.1.1.0/24",
+				"c3": "10.1.2.0/24",
+			},
+		},
+		{
+			name: "case 1: all pairs of three duplicates are reported",
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.0/24",
+				"c2": "10.1.0.0/24",
+				"c3": "10.1.0.0/24",
+			},
+			expectedConflicts: 3,
+			errorMatcher:      IsAlreadyExists,
+		},
+		{
+			name: "case 2: overlapping subnets",
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.0/16",
+				"c2": "10.1.1.0/24",
+				"c3": "10.1.2.0/24",
+			},
+			expectedConflicts: 2,
+			errorMatcher:      IsSubnetsOverlap,
+		},
+		{
+			name: "case 3: subnets within network range",
+			config: Config{
+				NetworkRange:   "10.1.0.0/16",
+				ReservedRanges: []string{"172.17.0.0/16"},
+				SubnetSize:     24,
+			},
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.0/24",
+				"c2": "10.1.255.0/24",
+			},
+		},
+		{
+			name: "case 4: subnet outside of network range",
+			config: Config{
+				NetworkRange: "10.1.0.0/16",
+			},
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.0/24",
+				"c2": "10.2.0.0/24",
+			},
+			errorMatcher: IsInvalidSubnet,
+		},
+		{
+			name: "case 5: subnet exceeds network range",
+			config: Config{
+				NetworkRange: "10.1.0.0/16",
+			},
+			allocatedSubnets: map[string]string{
+				"c1": "10.0.0.0/15",
+			},
+			errorMatcher: IsInvalidSubnet,
+		},
+		{
+			name: "case 6: unexpected subnet size",
+			config: Config{
+				SubnetSize: 24,
+			},
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.0/24",
+				"c2": "10.1.2.0/23",
+			},
+			errorMatcher: IsInvalidSubnet,
+		},
+		{
+			name: "case 7: subnet overlaps reserved range",
+			config: Config{
+				ReservedRanges: []string{"172.16.0.0/12"},
+			},
+			allocatedSubnets: map[string]string{
+				"c1": "172.17.0.0/24",
+			},
+			errorMatcher: IsInvalidSubnet,
+		},
+		{
+			name: "case 8: subnet is not a network address",
+			allocatedSubnets: map[string]string{
+				"c1": "10.1.0.1/24",
+			},
+			errorMatcher: IsInvalidSubnet,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			tc.config.Logger = microloggertest.New()
+			tc.config.Provider = newProviderFake(allocateSequential, 0)
+			tc.config.ClusterID = "test"
+
+			c, err := New(tc.config)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = c.verifySubnets(context.Background(), tc.allocatedSubnets, nil, nil, 0)
+
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("%s: error == %#v, want nil", tc.name, err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("%s: error == nil, want non-nil", tc.name)
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("%s: error == %#v, want matching", tc.name, err)
+			}
+
+			if tc.expectedConflicts > 0 && !strings.Contains(err.Error(), fmt.Sprintf("%d conflicting pairs", tc.expectedConflicts)) {
+				t.Fatalf("%s: error == %q, want %d conflicting pairs", tc.name, err.Error(), tc.expectedConflicts)
+			}
+		})
+	}
+}
@@ -2,18 +2,33 @@ package ipam
 
 import "context"
 
+const (
+	defaultChurnRounds  = 1
+	defaultChurnSize    = 1
+	defaultClusterCount = 3
+)
+
 type Interface interface {
 	// Test executes the cluster IPAM test using the configured provider
 	// implementation. The test processes the following steps to ensure the
 	// provider specific operator implements guest cluster IPAM correctly.
 	//
-	//     - Create guest clusters #1, #2, #3.
+	//     - Create Config.ClusterCount guest clusters, concurrently if
+	//       Config.ConcurrentCreation is set.
 	//     - Wait for guest clusters to be ready.
-	//     - Verify that clusters have distinct subnets.
-	//     - Terminate guest cluster #2 and immediately create guest cluster #4.
-	//     - Wait for guest clusters to be deleted and created.
-	//     - Verify that clusters have distinct subnets and created cluster #4 did
-	//       not receive same subnet that deleted cluster #2 had.
+	//     - Verify that clusters have distinct subnets. All conflicting pairs
+	//       of clusters are reported.
+	//     - Verify that all subnets lie within Config.NetworkRange, have the
+	//       mask size Config.SubnetSize and do not overlap with
+	//       Config.ReservedRanges. This is repeated for every verification
+	//       below.
+	//     - Run Config.ChurnRounds churn rounds, each of which:
+	//         - Terminates Config.ChurnSize random guest clusters and
+	//           immediately creates the same number of new guest clusters.
+	//         - Waits for guest clusters to be deleted and created.
+	//         - Verifies that all clusters have distinct subnets and created
+	//           clusters did not receive subnets freed within the last
+	//           Config.QuarantineRounds churn rounds.
 	//     - Delete guest clusters.
 	//
 	Test(ctx context.Context) error